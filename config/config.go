@@ -1,43 +1,246 @@
 package config
 
 import (
-	"fmt"
 	"os"
 	"time"
 )
 
 type Server struct {
 	Host string `json:"host"`
-	Port int    `json:"port"`
+	// Port is the TCP port to listen on, -1 disables the TCP listener.
+	Port int `json:"port"`
+	// Socket is a path of a Unix socket to listen on.
+	Socket string `json:"socket"`
+	// SocketPerm are the permissions of the Unix socket file.
+	SocketPerm os.FileMode `json:"socketPerm"`
+	// MaxItemSize is the maximum size of a stored value in bytes.
+	MaxItemSize int `json:"maxItemSize"`
+	// ReadBufferSize is the size of a per-connection read buffer in bytes.
+	ReadBufferSize int `json:"readBufferSize"`
+	// WriteBufferSize is the size of a per-connection write buffer in bytes.
+	WriteBufferSize int `json:"writeBufferSize"`
+	// MaxConnections is the maximum number of simultaneous client connections, zero means no limit.
+	MaxConnections int `json:"maxConnections"`
+	// MaxScanLimit is the maximum number of items returned by a scan command.
+	MaxScanLimit int `json:"maxScanLimit"`
+	// MaxPipelineDepth is the maximum number of pipelined gets of a connection looked up concurrently.
+	MaxPipelineDepth int `json:"maxPipelineDepth"`
+	// AsyncWriteConcurrency is the number of workers writing noreply sets, later commands of a key wait for them.
+	AsyncWriteConcurrency int `json:"asyncWriteConcurrency"`
+	// AsyncWriteQueueSize is the number of noreply sets waiting for a worker before connections block.
+	AsyncWriteQueueSize int `json:"asyncWriteQueueSize"`
+	// IdleTimeout closes connections which do not send a command for the given time.
+	IdleTimeout time.Duration `json:"idleTimeout"`
+	// ReadTimeout is the maximum time to read the rest of a started command.
+	ReadTimeout time.Duration `json:"readTimeout"`
+	// WriteTimeout is the maximum time to write a response.
+	WriteTimeout time.Duration `json:"writeTimeout"`
+	// ShutdownTimeout is the maximum time to finish served requests and queued writes on SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration `json:"shutdownTimeout"`
+	// TLS enables TLS on the listeners when a certificate is configured.
+	TLS TLS `json:"tls"`
+	// Auth requires clients to authenticate when a credentials source is configured.
+	Auth Auth `json:"auth"`
+	// ReadOnly starts the server in read-only mode, which can be toggled at runtime by "readonly <on|off>".
+	ReadOnly bool `json:"readOnly"`
+	// AdminUsers may issue administrative commands. When empty, everybody may without auth and nobody with auth.
+	AdminUsers []string `json:"adminUsers"`
 }
 
-// mysqlConnectionTmpl is a MySQL connection string template in the form
-// <user>:<password>@tcp(<host>:<port>).
-const mysqlConnectionTmpl = "%s:%s@tcp(%s:%d)"
+type Auth struct {
+	// File is a path to a file with one <username>:<password> pair per line.
+	File string `json:"file"`
+	// Table is a MySQL table holding credentials in the UserColumn and PasswordColumn.
+	Table          string `json:"table"`
+	UserColumn     string `json:"userColumn"`
+	PasswordColumn string `json:"passwordColumn"`
+	// PasswordHash is the hash of passwords in the PasswordColumn, plain or sha256 (hex encoded).
+	// The sha256 digests are unsalted, the column must hold generated service credentials, not user passwords.
+	PasswordHash string `json:"passwordHash"`
+}
+
+// Hashes of passwords stored in an auth table.
+const (
+	PasswordHashPlain  = "plain"
+	PasswordHashSHA256 = "sha256"
+)
+
+// Enabled checks whether a credentials source is configured.
+func (a Auth) Enabled() bool {
+	return a.File != "" || a.Table != ""
+}
+
+type TLS struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ClientCAFile enables mutual TLS, clients have to present a certificate signed by one of the CAs.
+	ClientCAFile string `json:"clientCAFile"`
+	// MinVersion is the minimum TLS version, one of 1.0, 1.1, 1.2 or 1.3.
+	MinVersion string `json:"minVersion"`
+}
+
+// Enabled checks whether TLS is configured.
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
 
 type MySQL struct {
-	Connection      string
-	Password        string        `json:"password"`
-	User            string        `json:"user"`
+	Password string `json:"password"`
+	User     string `json:"user"`
+	// PasswordFile and UserFile are paths to files holding the credentials, e.g. mounted
+	// Kubernetes or Docker secrets. They take precedence over Password and User and are
+	// re-read for every new connection, so rotated credentials are picked up.
+	PasswordFile    string        `json:"passwordFile"`
+	UserFile        string        `json:"userFile"`
 	Host            string        `json:"host"`
 	Port            int           `json:"port"`
 	Database        string        `json:"database"`
 	ConnMaxLifetime time.Duration `json:"connMaxLifetime"`
 	MaxOpenConns    int           `json:"maxOpenConns"`
 	MaxIdleConns    int           `json:"maxIdleConns"`
+	// Timeout is the timeout for establishing new connections.
+	Timeout time.Duration `json:"timeout"`
+	// ReadTimeout and WriteTimeout are I/O timeouts of a connection.
+	ReadTimeout  time.Duration `json:"readTimeout"`
+	WriteTimeout time.Duration `json:"writeTimeout"`
+	// ParseTime makes the driver return DATE and DATETIME values as time.Time.
+	ParseTime bool `json:"parseTime"`
+	// Charset is the connection character set, e.g. utf8mb4.
+	Charset   string `json:"charset"`
+	Collation string `json:"collation"`
+	// Params are session system variables set on every new connection, e.g. sql_mode.
+	Params map[string]string `json:"params"`
+	TLS    MySQLTLS          `json:"tls"`
+	Auth   MySQLAuth         `json:"auth"`
+	// StrictSchema refuses to start when a mapping does not match the schema of its table,
+	// otherwise such mappings are disabled.
+	StrictSchema bool `json:"strictSchema"`
 }
 
 type Config struct {
 	Server  Server    `json:"server"`
 	MySQL   MySQL     `json:"mysql"`
 	Mapping []Mapping `json:"mapping"`
+	// MappingSeparator ends the mapping name in keys of the form @@<mapping><separator><key>, . by default.
+	// Everything after the first separator is the key, so pick one which does not occur in mapping names.
+	MappingSeparator string `json:"mappingSeparator"`
+	// Routes send keys without the @@<mapping>. syntax to mappings, keys matching no route use the default mapping.
+	Routes []Route `json:"routes"`
+}
+
+// Route sends keys to a mapping by a prefix or a regular expression, exactly one of them has to be set.
+// The longest matching prefix wins, regular expressions are tried in order when no prefix matches.
+type Route struct {
+	Prefix  string `json:"prefix"`
+	Regex   string `json:"regex"`
+	Mapping string `json:"mapping"`
 }
 
 type Mapping struct {
-	Name        string `json:"name"`
+	Name string `json:"name"`
+	// KeyColumn is a column or a list of columns separated by |, forming a composite key.
 	KeyColumn   string `json:"keyColumn"`
 	ValueColumn string `json:"valueColumn"`
 	Table       string `json:"table"`
+	// KeyDelimiter splits keys into parts of a composite key, : by default.
+	KeyDelimiter string `json:"keyDelimiter"`
+	// Query replaces the generated SELECT. It takes a ? parameter for each key column and
+	// returns the value columns in order, Table is optional then.
+	Query string `json:"query"`
+	// WriteQuery replaces the generated INSERT ... ON DUPLICATE KEY UPDATE. It takes ? parameters
+	// for the key columns followed by the value columns. A mapping with a query and no table or
+	// write query does not accept writes.
+	WriteQuery string `json:"writeQuery"`
+	// Lookups are secondary unique columns the mapping can be read by, using keys of the form @@<mapping>:<column>.<key>.
+	Lookups []string `json:"lookups"`
+	// WriteBehind buffers writes and flushes them in batches instead of writing every set through.
+	WriteBehind WriteBehind `json:"writeBehind"`
+	// KeyTransform is a pipeline of steps applied in order to keys before the lookup.
+	KeyTransform []KeyTransform `json:"keyTransform"`
+	// ACL restricts access to the mapping, everybody has full access when empty.
+	ACL []ACL `json:"acl"`
+	// ReadOnly refuses all writes and deletes through the mapping regardless of the ACL.
+	ReadOnly bool `json:"readOnly"`
+	// Encoding of multiple value columns into a single value, delimited by default.
+	Encoding string `json:"encoding"`
+	// Separator of values in the delimited encoding, | by default.
+	Separator string `json:"separator"`
+	// Escape prefixes separators and backslashes within values with a backslash in the delimited encoding.
+	Escape bool `json:"escape"`
+	// NullToken represents SQL NULL in the delimited encoding, e.g. \N. Without it NULL is returned as an empty value.
+	NullToken string `json:"nullToken"`
+	// NullFlag marks values whose columns are all NULL with the FlagNull item flag and an empty value.
+	NullFlag bool `json:"nullFlag"`
+}
+
+// Encodings of multiple value columns.
+const (
+	// EncodingDelimited joins values with a separator.
+	EncodingDelimited = "delimited"
+	// EncodingLengthPrefixed writes values as netstrings, i.e. <length>:<value>, one after another.
+	EncodingLengthPrefixed = "length-prefixed"
+	// EncodingJSON writes values as a JSON object keyed by column names.
+	EncodingJSON = "json"
+	// EncodingMsgpack writes values as a MessagePack map keyed by column names.
+	EncodingMsgpack = "msgpack"
+)
+
+// Permissions which can be granted on a mapping.
+const (
+	PermissionRead   = "read"
+	PermissionWrite  = "write"
+	PermissionDelete = "delete"
+)
+
+// WriteBehind buffers writes of a mapping, coalescing writes of the same key with the last write winning,
+// and flushes them as multi-row INSERT ... ON DUPLICATE KEY UPDATE statements. Buffered writes are not
+// visible to reads until flushed. Rows of a failed statement are retried one by one, rows which still fail are lost.
+type WriteBehind struct {
+	Enabled bool `json:"enabled"`
+	// BatchSize is the number of buffered keys which triggers a flush and the maximum rows of a statement.
+	BatchSize int `json:"batchSize"`
+	// FlushInterval is the maximum time a write stays buffered.
+	FlushInterval time.Duration `json:"flushInterval"`
+	// QueueSize is the maximum number of buffered keys.
+	QueueSize int `json:"queueSize"`
+	// Backpressure applied to writes when the queue is full, block waits for a flush while reject fails the write.
+	Backpressure string `json:"backpressure"`
+}
+
+// Backpressure policies of write-behind queues.
+const (
+	BackpressureBlock  = "block"
+	BackpressureReject = "reject"
+)
+
+// KeyTransform is a single step of a key transformation pipeline, exactly one of the fields has to be set.
+type KeyTransform struct {
+	// StripPrefix removes the prefix from keys, keys without it are rejected.
+	StripPrefix string `json:"stripPrefix"`
+	// Regex replaces keys by the first capture group of the expression, keys not matching it are rejected.
+	Regex string `json:"regex"`
+	// Case folds keys to lower or upper case.
+	Case string `json:"case"`
+	// Hash replaces keys by their hex encoded sha1 or sha256 digest.
+	Hash string `json:"hash"`
+	// Integer binds keys as integers, keys which are not decimal integers are rejected.
+	Integer bool `json:"integer"`
+}
+
+// Key transformation cases and hashes.
+const (
+	CaseLower  = "lower"
+	CaseUpper  = "upper"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+)
+
+type ACL struct {
+	// Principal identifies clients, one of user:<name> for authenticated users, cn:<name> for
+	// common names of mutual TLS certificates, ip:<address or CIDR> or * for everybody.
+	Principal string `json:"principal"`
+	// Permissions granted to the principal, any of read, write and delete.
+	Permissions []string `json:"permissions"`
 }
 
 func (c *Mapping) EnsureDefault() {
@@ -50,18 +253,56 @@ func (c *Mapping) EnsureDefault() {
 	if c.ValueColumn == "" {
 		c.ValueColumn = "value"
 	}
+	if c.KeyDelimiter == "" {
+		c.KeyDelimiter = ":"
+	}
+	if c.WriteBehind.Enabled {
+		if c.WriteBehind.BatchSize == 0 {
+			c.WriteBehind.BatchSize = 100
+		}
+		if c.WriteBehind.FlushInterval == 0 {
+			c.WriteBehind.FlushInterval = time.Second
+		}
+		if c.WriteBehind.QueueSize == 0 {
+			c.WriteBehind.QueueSize = 10000
+		}
+		if c.WriteBehind.Backpressure == "" {
+			c.WriteBehind.Backpressure = BackpressureBlock
+		}
+	}
+	if c.Encoding == "" {
+		c.Encoding = EncodingDelimited
+	}
+	if c.Separator == "" {
+		c.Separator = "|"
+	}
 }
 
 func (c *Config) EnsureDefault() {
+	if c.MappingSeparator == "" {
+		c.MappingSeparator = "."
+	}
 	if c.Server.Port == 0 {
 		c.Server.Port = 11211
 	}
+	if c.Server.ShutdownTimeout == 0 {
+		c.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if c.Server.Socket != "" && c.Server.SocketPerm == 0 {
+		c.Server.SocketPerm = 0o700
+	}
+	if c.Server.Auth.UserColumn == "" {
+		c.Server.Auth.UserColumn = "user"
+	}
+	if c.Server.Auth.PasswordColumn == "" {
+		c.Server.Auth.PasswordColumn = "password"
+	}
+	if c.Server.Auth.PasswordHash == "" {
+		c.Server.Auth.PasswordHash = PasswordHashPlain
+	}
 
-	c.MySQL.User = os.ExpandEnv(c.MySQL.User)
-
-	c.MySQL.Connection = fmt.Sprintf(mysqlConnectionTmpl, c.MySQL.User, c.MySQL.Password, c.MySQL.Host, c.MySQL.Port)
-	if c.MySQL.Database != "" {
-		c.MySQL.Connection = fmt.Sprintf("%s/%s", c.MySQL.Connection, c.MySQL.Database)
+	if c.MySQL.Port == 0 {
+		c.MySQL.Port = 3306
 	}
 
 	if c.MySQL.ConnMaxLifetime == 0 {
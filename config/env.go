@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+)
+
+// expandEnv replaces ${var} or $var in all strings of settings v, as read from
+// the configuration file, with values of environment variables. A literal $ is written as $$.
+func expandEnv(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return expand(v)
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = expandEnv(e)
+		}
+	case map[interface{}]interface{}:
+		for k, e := range v {
+			v[k] = expandEnv(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = expandEnv(e)
+		}
+	}
+	return v
+}
+
+func expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return os.Getenv(name)
+	})
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_expandEnv(t *testing.T) {
+	t.Setenv("MYSQL_HOST", "db.example.com")
+	t.Setenv("TABLE", "users")
+	settings := map[string]interface{}{
+		"mysql": map[string]interface{}{
+			"host":     "$MYSQL_HOST",
+			"password": "pa$$word",
+			"port":     3306,
+			"params":   map[string]interface{}{"time_zone": "${TZ_UNSET}+00:00"},
+		},
+		"mapping": []interface{}{map[string]interface{}{"table": "db.${TABLE}"}},
+	}
+	expandEnv(settings)
+	require.Equal(t, map[string]interface{}{
+		"mysql": map[string]interface{}{
+			"host":     "db.example.com",
+			"password": "pa$word",
+			"port":     3306,
+			"params":   map[string]interface{}{"time_zone": "+00:00"},
+		},
+		"mapping": []interface{}{map[string]interface{}{"table": "db.users"}},
+	}, settings)
+}
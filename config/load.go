@@ -0,0 +1,32 @@
+package config
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Load reads the configuration file, expanding environment variables in its values, and overrides
+// the values with environment variables named after the keys, e.g. MYSQL_PASSWORD for mysql.password.
+// Values of the overriding variables are taken verbatim. Defaults are filled in and the configuration
+// is validated. Unknown keys and all validation errors are returned joined together.
+func Load(path string) (Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	c := Config{}
+	if err := v.ReadInConfig(); err != nil {
+		return c, err
+	}
+	// Expand the file values before enabling the overrides, so that only they are expanded.
+	if err := v.MergeConfigMap(expandEnv(v.AllSettings()).(map[string]interface{})); err != nil {
+		return c, err
+	}
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	// Unknown keys do not prevent decoding the rest, report them along with validation errors.
+	err := v.UnmarshalExact(&c)
+	c.EnsureDefault()
+	return c, errors.Join(err, c.Validate())
+}
@@ -0,0 +1,235 @@
+package config
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlRegisteredName is the name under which the TLS configuration and the server
+// public key are registered with the MySQL driver.
+const mysqlRegisteredName = "memcached-mysql"
+
+// TLS modes of the MySQL connection as understood by the MySQL driver.
+const (
+	MySQLTLSDisabled   = "false"
+	MySQLTLSPreferred  = "preferred"
+	MySQLTLSRequired   = "true"
+	MySQLTLSSkipVerify = "skip-verify"
+)
+
+type MySQLTLS struct {
+	// Mode is one of false, preferred, true or skip-verify. Defaults to false.
+	Mode string `json:"mode"`
+	// CAFile is a path to PEM encoded certificate authorities used to verify the server certificate.
+	CAFile string `json:"caFile"`
+	// CertFile and KeyFile are paths to a PEM encoded client certificate and its private key.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ServerName overrides the host name used to verify the server certificate.
+	ServerName string `json:"serverName"`
+}
+
+// custom checks whether the TLS configuration has to be registered with the driver
+// as opposed to using one of the driver predefined modes.
+func (t MySQLTLS) custom() bool {
+	return t.Mode != MySQLTLSDisabled && (t.CAFile != "" || t.CertFile != "" || t.ServerName != "")
+}
+
+type MySQLAuth struct {
+	// AllowCleartextPasswords enables the mysql_clear_password plugin, use only with TLS.
+	AllowCleartextPasswords bool `json:"allowCleartextPasswords"`
+	// AllowOldPasswords enables the insecure mysql_old_password plugin.
+	AllowOldPasswords bool `json:"allowOldPasswords"`
+	// DisableNativePasswords disables the mysql_native_password plugin.
+	DisableNativePasswords bool `json:"disableNativePasswords"`
+	// ServerPubKeyFile is a path to the PEM encoded RSA public key of the server used
+	// by sha256_password and caching_sha2_password over plaintext connections.
+	ServerPubKeyFile string `json:"serverPubKeyFile"`
+}
+
+// DriverConfig assembles the MySQL driver configuration.
+func (c *MySQL) DriverConfig() *mysql.Config {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	cfg.DBName = c.Database
+	cfg.Timeout = c.Timeout
+	cfg.ReadTimeout = c.ReadTimeout
+	cfg.WriteTimeout = c.WriteTimeout
+	cfg.ParseTime = c.ParseTime
+	if c.Collation != "" {
+		cfg.Collation = c.Collation
+	}
+	if len(c.Params) > 0 || c.Charset != "" {
+		cfg.Params = make(map[string]string, len(c.Params)+1)
+		for k, v := range c.Params {
+			cfg.Params[k] = v
+		}
+		if c.Charset != "" {
+			cfg.Params["charset"] = c.Charset
+		}
+	}
+	cfg.TLSConfig = c.TLS.Mode
+	if c.TLS.custom() {
+		cfg.TLSConfig = mysqlRegisteredName
+		cfg.AllowFallbackToPlaintext = c.TLS.Mode == MySQLTLSPreferred
+	}
+	cfg.AllowCleartextPasswords = c.Auth.AllowCleartextPasswords
+	cfg.AllowOldPasswords = c.Auth.AllowOldPasswords
+	cfg.AllowNativePasswords = !c.Auth.DisableNativePasswords
+	if c.Auth.ServerPubKeyFile != "" {
+		cfg.ServerPubKey = mysqlRegisteredName
+	}
+	return cfg
+}
+
+// RegisterDriverConfig loads the TLS configuration and the server public key
+// and registers them with the MySQL driver. It has to be called before opening the connection.
+func (c *MySQL) RegisterDriverConfig() error {
+	if c.TLS.custom() {
+		tlsConfig, err := c.TLS.load(c.Host)
+		if err != nil {
+			return fmt.Errorf("failed to load MySQL TLS configuration: %w", err)
+		}
+		if err := mysql.RegisterTLSConfig(mysqlRegisteredName, tlsConfig); err != nil {
+			return err
+		}
+	}
+	if c.Auth.ServerPubKeyFile != "" {
+		key, err := loadRSAPublicKey(c.Auth.ServerPubKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load MySQL server public key: %w", err)
+		}
+		mysql.RegisterServerPubKey(mysqlRegisteredName, key)
+	}
+	return nil
+}
+
+func (t MySQLTLS) load(host string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.Mode == MySQLTLSSkipVerify, // #nosec G402 -- explicitly requested by the configuration.
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in the CA file")
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func loadRSAPublicKey(name string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+	return key, nil
+}
+
+// Connector creates a connector for the configured MySQL server. When UserFile or PasswordFile
+// is set, the files are read every time a new connection is opened.
+func (c *MySQL) Connector() (driver.Connector, error) {
+	cfg := c.DriverConfig()
+	if c.UserFile == "" && c.PasswordFile == "" {
+		return mysql.NewConnector(cfg)
+	}
+	conn := &credentialsConnector{
+		cfg:          cfg,
+		userFile:     c.UserFile,
+		passwordFile: c.PasswordFile,
+	}
+	// Fail early instead of on the first connection.
+	if _, err := conn.connector(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// credentialsConnector opens connections with credentials read from files.
+type credentialsConnector struct {
+	cfg          *mysql.Config
+	userFile     string
+	passwordFile string
+}
+
+func (c *credentialsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Connect(ctx)
+}
+
+func (c *credentialsConnector) Driver() driver.Driver {
+	return mysql.MySQLDriver{}
+}
+
+func (c *credentialsConnector) connector() (driver.Connector, error) {
+	cfg := c.cfg.Clone()
+	if c.userFile != "" {
+		user, err := readSecret(c.userFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.User = user
+	}
+	if c.passwordFile != "" {
+		password, err := readSecret(c.passwordFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Passwd = password
+	}
+	return mysql.NewConnector(cfg)
+}
+
+// readSecret reads a secret from the file, ignoring the trailing newline.
+func readSecret(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
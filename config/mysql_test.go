@@ -0,0 +1,72 @@
+package config
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySQL_DriverConfig(t *testing.T) {
+	// ParseDSN refuses unknown TLS configuration names.
+	require.NoError(t, mysql.RegisterTLSConfig(mysqlRegisteredName, &tls.Config{MinVersion: tls.VersionTLS12}))
+	defer mysql.DeregisterTLSConfig(mysqlRegisteredName)
+
+	tests := []struct {
+		name  string
+		mysql MySQL
+		want  string
+	}{
+		{
+			name:  "plain",
+			mysql: MySQL{User: "user", Password: "pwd", Host: "localhost", Port: 3306, Database: "db"},
+			want:  "user:pwd@tcp(localhost:3306)/db",
+		},
+		{
+			name:  "password with special characters",
+			mysql: MySQL{User: "user", Password: "p@ss/w:rd?", Host: "localhost", Port: 3306},
+			want:  "user:p@ss/w:rd?@tcp(localhost:3306)/",
+		},
+		{
+			name: "driver parameters",
+			mysql: MySQL{
+				User: "user", Host: "localhost", Port: 3306, Database: "db",
+				ParseTime: true, Charset: "utf8mb4", Params: map[string]string{"sql_mode": "TRADITIONAL"},
+			},
+			want: "user@tcp(localhost:3306)/db?parseTime=true&charset=utf8mb4&sql_mode=TRADITIONAL",
+		},
+		{
+			name:  "predefined TLS mode",
+			mysql: MySQL{User: "user", Host: "localhost", Port: 3306, TLS: MySQLTLS{Mode: MySQLTLSSkipVerify}},
+			want:  "user@tcp(localhost:3306)/?tls=skip-verify",
+		},
+		{
+			name:  "custom TLS",
+			mysql: MySQL{User: "user", Host: "localhost", Port: 3306, TLS: MySQLTLS{Mode: MySQLTLSRequired, CAFile: "ca.crt"}},
+			want:  "user@tcp(localhost:3306)/?tls=memcached-mysql",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := tt.mysql.DriverConfig().FormatDSN()
+			require.Equal(t, tt.want, dsn)
+			parsed, err := mysql.ParseDSN(dsn)
+			require.NoError(t, err)
+			require.Equal(t, tt.mysql.Password, parsed.Passwd)
+		})
+	}
+}
+
+func Test_readSecret(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(name, []byte("s3cr$t\n"), 0o600))
+	got, err := readSecret(name)
+	require.NoError(t, err)
+	require.Equal(t, "s3cr$t", got)
+
+	_, err = (&MySQL{Host: "localhost", Port: 3306, PasswordFile: filepath.Join(t.TempDir(), "missing")}).Connector()
+	require.Error(t, err)
+}
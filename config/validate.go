@@ -0,0 +1,310 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxIdentifierLength is the maximum length of a MySQL identifier.
+const maxIdentifierLength = 64
+
+var (
+	mysqlTLSModes  = []string{"", MySQLTLSDisabled, MySQLTLSPreferred, MySQLTLSRequired, MySQLTLSSkipVerify}
+	tlsVersions    = []string{"", "1.0", "1.1", "1.2", "1.3"}
+	permissions    = []string{PermissionRead, PermissionWrite, PermissionDelete}
+	principals     = []string{"user", "cn", "ip"}
+	encodings      = []string{EncodingDelimited, EncodingLengthPrefixed, EncodingJSON, EncodingMsgpack}
+	cases          = []string{CaseLower, CaseUpper}
+	hashes         = []string{HashSHA1, HashSHA256}
+	passwordHashes = []string{PasswordHashPlain, PasswordHashSHA256}
+	backpressures  = []string{BackpressureBlock, BackpressureReject}
+)
+
+// Validate checks the configuration, which has defaults filled in, for semantic errors.
+// All found errors are returned joined together.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Server.Port != -1 && !validPort(c.Server.Port) {
+		add("server.port: %d is not a valid port, use -1 to disable TCP", c.Server.Port)
+	}
+	if c.Server.Port == -1 && c.Server.Socket == "" {
+		add("server: either port or socket has to be set")
+	}
+	for _, size := range []struct {
+		name  string
+		value int
+	}{
+		{"maxItemSize", c.Server.MaxItemSize},
+		{"readBufferSize", c.Server.ReadBufferSize},
+		{"writeBufferSize", c.Server.WriteBufferSize},
+		{"maxConnections", c.Server.MaxConnections},
+		{"maxScanLimit", c.Server.MaxScanLimit},
+		{"maxPipelineDepth", c.Server.MaxPipelineDepth},
+		{"asyncWriteConcurrency", c.Server.AsyncWriteConcurrency},
+		{"asyncWriteQueueSize", c.Server.AsyncWriteQueueSize},
+	} {
+		if size.value < 0 {
+			add("server.%s: must not be negative", size.name)
+		}
+	}
+	if c.Server.IdleTimeout < 0 || c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.ShutdownTimeout < 0 {
+		add("server: timeouts must not be negative")
+	}
+	if c.Server.TLS.Enabled() && c.Server.TLS.KeyFile == "" {
+		add("server.tls.keyFile: has to be set together with certFile")
+	}
+	if !c.Server.TLS.Enabled() && (c.Server.TLS.KeyFile != "" || c.Server.TLS.ClientCAFile != "") {
+		add("server.tls.certFile: has to be set to enable TLS")
+	}
+	if !contains(tlsVersions, c.Server.TLS.MinVersion) {
+		add("server.tls.minVersion: unsupported version %q", c.Server.TLS.MinVersion)
+	}
+	if c.Server.Auth.File != "" && c.Server.Auth.Table != "" {
+		add("server.auth: only one of file and table can be set")
+	}
+	if c.Server.Auth.Table != "" {
+		if err := validTableName(c.Server.Auth.Table); err != nil {
+			add("server.auth.table: %w", err)
+		}
+		for _, column := range []string{c.Server.Auth.UserColumn, c.Server.Auth.PasswordColumn} {
+			if err := validIdentifier(column); err != nil {
+				add("server.auth: %w", err)
+			}
+		}
+		if !contains(passwordHashes, c.Server.Auth.PasswordHash) {
+			add("server.auth.passwordHash: unknown hash %q", c.Server.Auth.PasswordHash)
+		}
+	}
+
+	if c.MySQL.Host == "" {
+		add("mysql.host: must not be empty")
+	}
+	if !validPort(c.MySQL.Port) {
+		add("mysql.port: %d is not a valid port", c.MySQL.Port)
+	}
+	if !contains(mysqlTLSModes, c.MySQL.TLS.Mode) {
+		add("mysql.tls.mode: unsupported mode %q", c.MySQL.TLS.Mode)
+	}
+	if (c.MySQL.TLS.CertFile == "") != (c.MySQL.TLS.KeyFile == "") {
+		add("mysql.tls: certFile and keyFile have to be set together")
+	}
+
+	if strings.ContainsAny(c.MappingSeparator, "@ \t\r\n") {
+		add("mappingSeparator: must not contain @ or whitespace")
+	}
+	names := make(map[string]bool, len(c.Mapping))
+	for i, m := range c.Mapping {
+		field := fmt.Sprintf("mapping[%d] (%s)", i, m.Name)
+		if names[m.Name] {
+			add("%s: duplicate mapping name", field)
+		}
+		names[m.Name] = true
+		if c.MappingSeparator != "" && strings.Contains(m.Name, c.MappingSeparator) {
+			add("%s.name: must not contain the mapping separator %q", field, c.MappingSeparator)
+		}
+		if m.Query == "" || m.Table != "" {
+			if err := validTableName(m.Table); err != nil {
+				add("%s.table: %w", field, err)
+			}
+		}
+		keyColumns, valueColumns := strings.Split(m.KeyColumn, "|"), strings.Split(m.ValueColumn, "|")
+		for _, column := range keyColumns {
+			if err := validIdentifier(column); err != nil {
+				add("%s.keyColumn: %w", field, err)
+			}
+		}
+		for _, column := range valueColumns {
+			if err := validIdentifier(column); err != nil {
+				add("%s.valueColumn: %w", field, err)
+			}
+		}
+		if n := placeholders(m.Query); m.Query != "" && n != len(keyColumns) {
+			add("%s.query: takes %d parameters, expected %d key parameters", field, n, len(keyColumns))
+		}
+		if n := placeholders(m.WriteQuery); m.WriteQuery != "" && n != len(keyColumns)+len(valueColumns) {
+			add("%s.writeQuery: takes %d parameters, expected %d key and %d value parameters", field, n, len(keyColumns), len(valueColumns))
+		}
+		if !contains(encodings, m.Encoding) {
+			add("%s.encoding: unknown encoding %q", field, m.Encoding)
+		}
+		if m.Escape && strings.Contains(m.Separator, "\\") {
+			add("%s.separator: must not contain a backslash when escaping is enabled", field)
+		}
+		if m.NullToken != "" && m.Encoding != EncodingDelimited {
+			add("%s.nullToken: only supported by the delimited encoding", field)
+		}
+		if m.NullToken != "" && strings.Contains(m.NullToken, m.Separator) {
+			add("%s.nullToken: must not contain the separator", field)
+		}
+		if len(m.Lookups) > 0 && (m.Table == "" || strings.Contains(m.Name, ":")) {
+			add("%s.lookups: require a table and a mapping name without colons", field)
+		}
+		for _, column := range m.Lookups {
+			if err := validIdentifier(column); err != nil {
+				add("%s.lookups: %w", field, err)
+			}
+		}
+		if wb := m.WriteBehind; wb.Enabled {
+			if m.Table == "" || m.WriteQuery != "" {
+				add("%s.writeBehind: requires a table and no write query", field)
+			}
+			if wb.BatchSize < 1 || wb.QueueSize < wb.BatchSize || wb.FlushInterval <= 0 {
+				add("%s.writeBehind: batchSize and flushInterval have to be positive and queueSize at least batchSize", field)
+			}
+			if !contains(backpressures, wb.Backpressure) {
+				add("%s.writeBehind.backpressure: unknown policy %q", field, wb.Backpressure)
+			}
+		}
+		for j, t := range m.KeyTransform {
+			if err := validKeyTransform(t, len(keyColumns), j == len(m.KeyTransform)-1); err != nil {
+				add("%s.keyTransform[%d]: %w", field, j, err)
+			}
+		}
+		for j, acl := range m.ACL {
+			if err := validPrincipal(acl.Principal); err != nil {
+				add("%s.acl[%d].principal: %w", field, j, err)
+			}
+			for _, perm := range acl.Permissions {
+				if !contains(permissions, perm) {
+					add("%s.acl[%d].permissions: unknown permission %q", field, j, perm)
+				}
+			}
+		}
+	}
+	prefixes := make(map[string]bool, len(c.Routes))
+	for i, r := range c.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+		if (r.Prefix == "") == (r.Regex == "") {
+			add("%s: exactly one of prefix and regex has to be set", field)
+		}
+		if r.Prefix != "" && prefixes[r.Prefix] {
+			add("%s.prefix: duplicate prefix %q", field, r.Prefix)
+		}
+		prefixes[r.Prefix] = true
+		if _, err := regexp.Compile(r.Regex); err != nil {
+			add("%s.regex: %w", field, err)
+		}
+		if !names[r.Mapping] {
+			add("%s.mapping: unknown mapping %q", field, r.Mapping)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// placeholders counts ? parameters of the query outside of quoted strings and identifiers.
+func placeholders(query string) int {
+	n := 0
+	var quote rune
+	escaped := false
+	for _, r := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0 && r == '\\' && quote != '`':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+		}
+	}
+	return n
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// validTableName checks a table name optionally qualified by a database name.
+func validTableName(table string) error {
+	if table == "" {
+		return errors.New("must not be empty")
+	}
+	parts := strings.Split(table, ".")
+	if len(parts) > 2 {
+		return fmt.Errorf("%q has to be in the form <table> or <database>.<table>", table)
+	}
+	for _, part := range parts {
+		if err := validIdentifier(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validIdentifier checks the name can be used as a quoted MySQL identifier.
+func validIdentifier(name string) error {
+	switch {
+	case name == "":
+		return errors.New("identifier must not be empty")
+	case len(name) > maxIdentifierLength:
+		return fmt.Errorf("identifier %q is longer than %d characters", name, maxIdentifierLength)
+	case strings.ContainsAny(name, "`.\x00"):
+		return fmt.Errorf("identifier %q must not contain backticks, dots or NUL characters", name)
+	case strings.HasSuffix(name, " "):
+		return fmt.Errorf("identifier %q must not end with a space", name)
+	}
+	return nil
+}
+
+// validKeyTransform checks a step of a key transformation pipeline, last tells whether it is the last step.
+func validKeyTransform(t KeyTransform, keyColumns int, last bool) error {
+	steps := 0
+	for _, set := range []bool{t.StripPrefix != "", t.Regex != "", t.Case != "", t.Hash != "", t.Integer} {
+		if set {
+			steps++
+		}
+	}
+	if steps != 1 {
+		return errors.New("exactly one of stripPrefix, regex, case, hash and integer has to be set")
+	}
+	switch {
+	case t.Regex != "":
+		re, err := regexp.Compile(t.Regex)
+		if err != nil {
+			return err
+		}
+		if re.NumSubexp() == 0 {
+			return fmt.Errorf("regex %q has no capture group", t.Regex)
+		}
+	case t.Case != "" && !contains(cases, t.Case):
+		return fmt.Errorf("unknown case %q", t.Case)
+	case t.Hash != "" && !contains(hashes, t.Hash):
+		return fmt.Errorf("unknown hash %q", t.Hash)
+	case t.Integer && keyColumns > 1:
+		return errors.New("integer keys are not supported with composite keys")
+	case t.Integer && !last:
+		return errors.New("integer has to be the last step")
+	}
+	return nil
+}
+
+func validPrincipal(principal string) error {
+	if principal == "*" {
+		return nil
+	}
+	kind, value, ok := strings.Cut(principal, ":")
+	if !ok || value == "" || !contains(principals, kind) {
+		return fmt.Errorf("%q is not one of user:<name>, cn:<name>, ip:<address or CIDR> or *", principal)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
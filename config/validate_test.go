@@ -0,0 +1,200 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig() Config {
+	c := Config{
+		MySQL:   MySQL{Host: "localhost"},
+		Mapping: []Mapping{{Name: "default", Table: "db.test"}},
+	}
+	c.EnsureDefault()
+	return c
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr []string
+	}{
+		{
+			name:   "valid",
+			modify: func(*Config) {},
+		},
+		{
+			name: "invalid ports",
+			modify: func(c *Config) {
+				c.Server.Port = 70000
+				c.MySQL.Port = -1
+			},
+			wantErr: []string{"server.port: 70000 is not a valid port", "mysql.port: -1 is not a valid port"},
+		},
+		{
+			name:    "no listener",
+			modify:  func(c *Config) { c.Server.Port = -1 },
+			wantErr: []string{"server: either port or socket has to be set"},
+		},
+		{
+			name: "duplicate mapping",
+			modify: func(c *Config) {
+				c.Mapping = append(c.Mapping, c.Mapping[0])
+			},
+			wantErr: []string{"mapping[1] (default): duplicate mapping name"},
+		},
+		{
+			name: "empty table and illegal identifiers",
+			modify: func(c *Config) {
+				c.Mapping[0].Table = ""
+				c.Mapping[0].KeyColumn = "k`ey"
+				c.Mapping[0].ValueColumn = "value|"
+			},
+			wantErr: []string{
+				"mapping[0] (default).table: must not be empty",
+				"mapping[0] (default).keyColumn: identifier \"k`ey\" must not contain backticks",
+				"mapping[0] (default).valueColumn: identifier must not be empty",
+			},
+		},
+		{
+			name: "invalid null token",
+			modify: func(c *Config) {
+				c.Mapping[0].NullToken = "a|b"
+				c.Mapping = append(c.Mapping, Mapping{Name: "json", Table: "test", KeyColumn: "key", ValueColumn: "value", Encoding: EncodingJSON, Separator: "|", NullToken: `\N`})
+			},
+			wantErr: []string{
+				"mapping[0] (default).nullToken: must not contain the separator",
+				"mapping[1] (json).nullToken: only supported by the delimited encoding",
+			},
+		},
+		{
+			name: "custom queries",
+			modify: func(c *Config) {
+				c.Mapping[0].Table = ""
+				c.Mapping[0].Query = "SELECT `value` FROM `test` WHERE `key`=? AND `deleted_at` IS NULL"
+				c.Mapping = append(c.Mapping, Mapping{
+					Name: "users", KeyColumn: "id", ValueColumn: "name|note", KeyDelimiter: ":", Encoding: EncodingDelimited, Separator: "|",
+					Query:      "SELECT `name`, 'what?' FROM `users` WHERE `id`=? OR `parent`=?",
+					WriteQuery: "UPDATE `users` SET `name`=? WHERE `id`=?",
+				})
+			},
+			wantErr: []string{
+				"mapping[1] (users).query: takes 2 parameters, expected 1 key parameters",
+				"mapping[1] (users).writeQuery: takes 2 parameters, expected 1 key and 2 value parameters",
+			},
+		},
+		{
+			name: "invalid write behind",
+			modify: func(c *Config) {
+				c.Mapping[0].WriteBehind = WriteBehind{Enabled: true, BatchSize: 10, QueueSize: 5, FlushInterval: time.Second, Backpressure: "drop"}
+			},
+			wantErr: []string{
+				"mapping[0] (default).writeBehind: batchSize and flushInterval have to be positive and queueSize at least batchSize",
+				"mapping[0] (default).writeBehind.backpressure: unknown policy \"drop\"",
+			},
+		},
+		{
+			name: "invalid key transforms",
+			modify: func(c *Config) {
+				c.Mapping[0].KeyColumn = "tenant|id"
+				c.Mapping[0].KeyTransform = []KeyTransform{
+					{StripPrefix: "user:", Case: CaseLower},
+					{Regex: `^user:\d+$`},
+					{Hash: "md5"},
+					{Integer: true},
+				}
+				c.Mapping = append(c.Mapping, Mapping{
+					Name: "users", Table: "users", KeyColumn: "id", ValueColumn: "name", KeyDelimiter: ":", Encoding: EncodingDelimited, Separator: "|",
+					KeyTransform: []KeyTransform{{Integer: true}, {Hash: HashSHA1}},
+				})
+			},
+			wantErr: []string{
+				"mapping[1] (users).keyTransform[0]: integer has to be the last step",
+				"mapping[0] (default).keyTransform[0]: exactly one of stripPrefix, regex, case, hash and integer has to be set",
+				"mapping[0] (default).keyTransform[1]: regex \"^user:\\\\d+$\" has no capture group",
+				"mapping[0] (default).keyTransform[2]: unknown hash \"md5\"",
+				"mapping[0] (default).keyTransform[3]: integer keys are not supported with composite keys",
+			},
+		},
+		{
+			name: "mapping separator in mapping name",
+			modify: func(c *Config) {
+				c.MappingSeparator = "/"
+				c.Mapping[0].Name = "users/v2"
+			},
+			wantErr: []string{"mapping[0] (users/v2).name: must not contain the mapping separator \"/\""},
+		},
+		{
+			name: "invalid routes",
+			modify: func(c *Config) {
+				c.Routes = []Route{
+					{Prefix: "sess:", Mapping: "default"},
+					{Prefix: "sess:", Mapping: "default"},
+					{Prefix: "cnt:", Regex: "^cnt", Mapping: "default"},
+					{Regex: "(", Mapping: "counters"},
+				}
+			},
+			wantErr: []string{
+				"routes[1].prefix: duplicate prefix \"sess:\"",
+				"routes[2]: exactly one of prefix and regex has to be set",
+				"routes[3].regex: error parsing regexp",
+				"routes[3].mapping: unknown mapping \"counters\"",
+			},
+		},
+		{
+			name: "invalid acl",
+			modify: func(c *Config) {
+				c.Mapping[0].ACL = []ACL{{Principal: "group:ops", Permissions: []string{"admin"}}}
+			},
+			wantErr: []string{
+				"mapping[0] (default).acl[0].principal",
+				"mapping[0] (default).acl[0].permissions: unknown permission \"admin\"",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(&c)
+			err := c.Validate()
+			if len(tt.wantErr) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				require.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("mysql:\n  hostname: localhost\nmapping:\n- table: test\n"), 0o600))
+	c, err := Load(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid keys: hostname")
+	require.Contains(t, err.Error(), "mysql.host: must not be empty")
+	require.Equal(t, "default", c.Mapping[0].Name)
+
+	_, err = Load("../config.yaml")
+	require.NoError(t, err)
+}
+
+func TestLoad_env(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("mysql:\n  host: $DB_HOST\n  user: us$$er\n  password: file\n"), 0o600))
+	t.Setenv("DB_HOST", "db.example.com")
+	t.Setenv("MYSQL_PASSWORD", "p$ss0rd")
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, "db.example.com", c.MySQL.Host)
+	require.Equal(t, "us$er", c.MySQL.User)
+	require.Equal(t, "p$ss0rd", c.MySQL.Password)
+}
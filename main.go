@@ -1,36 +1,194 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/coufalja/memcached-mysql/config"
 	"github.com/coufalja/memcached-mysql/memcached"
 	"github.com/coufalja/memcached-mysql/mysql"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
 func main() {
-	db, err := sql.Open("mysql", conf.MySQL.Connection)
+	if err := conf.MySQL.RegisterDriverConfig(); err != nil {
+		logger.Panic("failed to configure mysql driver", zap.Error(err))
+	}
+	connector, err := conf.MySQL.Connector()
 	if err != nil {
 		logger.Panic("failed to open mysql connection", zap.Error(err))
 	}
+	db := sql.OpenDB(connector)
 	db.SetConnMaxLifetime(conf.MySQL.ConnMaxLifetime)
 	db.SetMaxOpenConns(conf.MySQL.MaxOpenConns)
 	db.SetMaxIdleConns(conf.MySQL.MaxIdleConns)
 	if err := db.Ping(); err != nil {
 		logger.Panic("could not connect to the mysql server", zap.Error(err))
 	}
+	mappings, routes := verifySchema(db)
 
-	proxy := memcached.NewServer(fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.Port), mysql.New(db, conf.Mapping))
+	var addr string
+	if conf.Server.Port > 0 {
+		addr = fmt.Sprintf("%s:%d", conf.Server.Host, conf.Server.Port)
+	}
+	tables, err := mysql.New(db, mappings)
+	if err != nil {
+		logger.Fatal("failed to prepare mappings", zap.Error(err))
+	}
+	tables.Logger = logger
+	tables.MappingSeparator = conf.MappingSeparator
+	if err := tables.SetRoutes(routes); err != nil {
+		logger.Panic("failed to configure routes", zap.Error(err))
+	}
+	proxy := memcached.NewServer(addr, tables)
+	for name, stat := range tables.Stats() {
+		proxy.Stats.Extra[name] = stat
+	}
+	proxy.Socket = conf.Server.Socket
+	proxy.SocketPerm = conf.Server.SocketPerm
+	proxy.MaxItemSize = conf.Server.MaxItemSize
+	proxy.ReadBufferSize = conf.Server.ReadBufferSize
+	proxy.WriteBufferSize = conf.Server.WriteBufferSize
+	proxy.MaxConnections = conf.Server.MaxConnections
+	proxy.MaxScanLimit = conf.Server.MaxScanLimit
+	proxy.MaxPipelineDepth = conf.Server.MaxPipelineDepth
+	proxy.AsyncWriteConcurrency = conf.Server.AsyncWriteConcurrency
+	proxy.AsyncWriteQueueSize = conf.Server.AsyncWriteQueueSize
+	proxy.ErrorLog = zap.NewStdLog(logger)
+	proxy.IdleTimeout = conf.Server.IdleTimeout
+	proxy.ReadTimeout = conf.Server.ReadTimeout
+	proxy.WriteTimeout = conf.Server.WriteTimeout
+	if conf.Server.TLS.Enabled() {
+		tlsConfig, err := memcached.NewTLSConfig(memcached.TLSOptions{
+			CertFile:     conf.Server.TLS.CertFile,
+			KeyFile:      conf.Server.TLS.KeyFile,
+			ClientCAFile: conf.Server.TLS.ClientCAFile,
+			MinVersion:   conf.Server.TLS.MinVersion,
+		})
+		if err != nil {
+			logger.Panic("failed to load TLS configuration", zap.Error(err))
+		}
+		proxy.TLSConfig = tlsConfig
+	}
+	proxy.SetReadOnly(conf.Server.ReadOnly)
+	proxy.AdminUsers = conf.Server.AdminUsers
+	if conf.Server.Auth.Enabled() {
+		proxy.Authenticator = newAuthenticator(db, conf.Server.Auth)
+		if len(conf.Server.AdminUsers) == 0 {
+			logger.Warn("auth is enabled without server.adminUsers, nobody may issue administrative commands")
+		}
+	}
 	logger.Info("memcached proxy starting")
-	if err := proxy.ListenAndServe(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- proxy.ListenAndServe() }()
+	select {
+	case err := <-served:
+		tables.Close()
 		logger.Panic("failed to start server", zap.Error(err))
+	case <-ctx.Done():
+	}
+	logger.Info("memcached proxy shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.Server.ShutdownTimeout)
+	defer cancel()
+	if err := proxy.Shutdown(shutdownCtx); err != nil {
+		logger.Error("failed to finish served requests", zap.Error(err))
+	}
+	// Flush writes buffered by write-behind mappings.
+	tables.Close()
+	if err := <-served; !errors.Is(err, memcached.ErrServerClosed) {
+		logger.Error("server failed", zap.Error(err))
+	}
+}
+
+func newAuthenticator(db *sql.DB, conf config.Auth) memcached.Authenticator {
+	if conf.File != "" {
+		auth, err := memcached.NewFileAuthenticator(conf.File)
+		if err != nil {
+			logger.Panic("failed to load credentials file", zap.Error(err))
+		}
+		return auth
+	}
+	auth, err := mysql.NewAuthenticator(db, conf.Table, conf.UserColumn, conf.PasswordColumn, conf.PasswordHash)
+	if err != nil {
+		logger.Panic("failed to prepare credentials query", zap.Error(err))
 	}
+	return auth
+}
+
+// verifySchema logs a report of every mapping verified against its table and
+// refuses to start on mismatches in the strict mode. Otherwise, mappings which do not
+// match are disabled along with routes to them, the remaining ones are returned.
+func verifySchema(db *sql.DB) ([]config.Mapping, []config.Route) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	reports, err := mysql.VerifySchema(ctx, db, conf.Mapping)
+	if err != nil {
+		if conf.MySQL.StrictSchema {
+			logger.Fatal("failed to verify schema", zap.Error(err))
+		}
+		logger.Warn("failed to verify schema", zap.Error(err))
+		return conf.Mapping, conf.Routes
+	}
+	failed := false
+	disabled := make(map[string]bool)
+	for _, r := range reports {
+		l := logger.With(zap.String("mapping", r.Mapping), zap.String("table", r.Table))
+		columns := make([]string, len(r.Columns))
+		for i, c := range r.Columns {
+			columns[i] = c.String()
+		}
+		l.Info("mapping schema", zap.Bool("keyUnique", r.KeyUnique), zap.Strings("columns", columns))
+		for _, w := range r.Warnings {
+			l.Warn(w)
+		}
+		for _, e := range r.Errors {
+			l.Error(e)
+			failed = true
+		}
+		if len(r.Errors) > 0 && !conf.MySQL.StrictSchema {
+			l.Error("mapping disabled as it does not match the schema")
+			disabled[r.Mapping] = true
+		}
+	}
+	if failed && conf.MySQL.StrictSchema {
+		logger.Fatal("mappings do not match the schema")
+	}
+	var mappings []config.Mapping
+	for _, m := range conf.Mapping {
+		if !disabled[m.Name] {
+			mappings = append(mappings, m)
+		}
+	}
+	var routes []config.Route
+	for _, r := range conf.Routes {
+		if disabled[r.Mapping] {
+			logger.Warn("route to a disabled mapping ignored", zap.String("mapping", r.Mapping))
+			continue
+		}
+		routes = append(routes, r)
+	}
+	return mappings, routes
+}
+
+// validate reports the result of loading and validating the configuration and returns the exit code.
+func validate(err error) int {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("configuration is valid")
+	return 0
 }
 
 var (
@@ -40,13 +198,18 @@ var (
 
 func init() {
 	pflag.String("config", "config.yaml", "Path to a config file.")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [validate] [flags]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "The validate command checks the config file, prints all errors and exits non-zero if there are any.")
+		fmt.Fprintln(os.Stderr)
+		pflag.PrintDefaults()
+	}
 
 	pflag.Parse()
 
 	_ = viper.BindPFlags(pflag.CommandLine)
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	viper.SetConfigFile(viper.GetString("config"))
 
 	l, err := zap.NewProductionConfig().Build()
 	if err != nil {
@@ -54,13 +217,17 @@ func init() {
 	}
 	logger = l
 
-	if err := viper.ReadInConfig(); err != nil {
-		logger.Error("failed to read in config", zap.Error(err))
+	c, err := config.Load(viper.GetString("config"))
+	switch pflag.Arg(0) {
+	case "":
+	case "validate":
+		os.Exit(validate(err))
+	default:
+		pflag.Usage()
+		os.Exit(2)
 	}
-	c := config.Config{}
-	if err := viper.Unmarshal(&c); err != nil {
-		logger.Error("failed to unmarshal config", zap.Error(err))
+	if err != nil {
+		logger.Fatal("invalid configuration", zap.Error(err))
 	}
-	c.EnsureDefault()
 	conf = c
 }
@@ -0,0 +1,52 @@
+package memcached
+
+import (
+	"bytes"
+	"strings"
+)
+
+// SetReadOnly switches the server to or from read-only mode, in which storage
+// and delete commands are refused.
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.readOnly.Store(readOnly)
+}
+
+// ReadOnly checks whether the server is in read-only mode.
+func (s *Server) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// isAdmin checks whether the client may issue administrative commands.
+// Without AdminUsers, everybody may unless clients authenticate, then nobody may.
+func (c *conn) isAdmin() bool {
+	if len(c.server.AdminUsers) == 0 {
+		return c.server.Authenticator == nil
+	}
+	for _, user := range c.server.AdminUsers {
+		if c.client.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReadOnly handles the "readonly <on|off>" command toggling the read-only mode.
+func (c *conn) handleReadOnly(line []byte) error {
+	f := bytes.Fields(line)
+	if len(f) != 2 || string(f[0]) != "readonly" {
+		return Error
+	}
+	if !c.isAdmin() {
+		return AccessDenied
+	}
+	switch strings.ToLower(string(f[1])) {
+	case "on":
+		c.server.SetReadOnly(true)
+	case "off":
+		c.server.SetReadOnly(false)
+	default:
+		return BadCommandLineFormat
+	}
+	c.rwc.WriteString(StatusOK)
+	return nil
+}
@@ -0,0 +1,127 @@
+package memcached
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// DefaultAsyncWriteConcurrency is the default number of workers executing noreply sets.
+	DefaultAsyncWriteConcurrency = 8
+	// DefaultAsyncWriteQueueSize is the default number of noreply sets waiting for a worker.
+	DefaultAsyncWriteQueueSize = 1024
+)
+
+// asyncWriter executes writes in the background by a fixed number of workers.
+// Writes of a key are always executed by the same worker, so they are applied in the order of submission.
+type asyncWriter struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+	// mu guards closed, submissions hold it for reading so that close waits for them.
+	mu     sync.RWMutex
+	closed bool
+
+	// keys track the progress of queued writes by key, so that requests can wait for them, see wait.
+	keysMu   sync.Mutex
+	keysCond *sync.Cond
+	keys     map[string]*keyProgress
+}
+
+// keyProgress counts the submitted and executed writes of a key.
+type keyProgress struct {
+	submitted, done uint64
+}
+
+func newAsyncWriter(concurrency, queueSize int) *asyncWriter {
+	perWorker := queueSize / concurrency
+	if perWorker < 1 {
+		perWorker = 1
+	}
+	w := &asyncWriter{
+		queues: make([]chan func(), concurrency),
+		keys:   make(map[string]*keyProgress),
+	}
+	w.keysCond = sync.NewCond(&w.keysMu)
+	for i := range w.queues {
+		w.queues[i] = make(chan func(), perWorker)
+		w.wg.Add(1)
+		go w.work(w.queues[i])
+	}
+	return w
+}
+
+func (w *asyncWriter) work(queue chan func()) {
+	defer w.wg.Done()
+	for write := range queue {
+		write()
+	}
+}
+
+// submit queues the write of the key, blocking while the queue of its worker is full.
+// Writes submitted after close are executed synchronously.
+func (w *asyncWriter) submit(key string, write func()) {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		write()
+		return
+	}
+	w.keysMu.Lock()
+	progress, ok := w.keys[key]
+	if !ok {
+		progress = &keyProgress{}
+		w.keys[key] = progress
+	}
+	progress.submitted++
+	w.keysMu.Unlock()
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	w.queues[h.Sum32()%uint32(len(w.queues))] <- func() {
+		write()
+		w.keysMu.Lock()
+		progress.done++
+		if progress.done == progress.submitted {
+			delete(w.keys, key)
+		}
+		w.keysMu.Unlock()
+		w.keysCond.Broadcast()
+	}
+	w.mu.RUnlock()
+}
+
+// wait waits for the writes of the key submitted so far to be executed.
+// Writes submitted while waiting are not waited for.
+func (w *asyncWriter) wait(key string) {
+	w.keysMu.Lock()
+	defer w.keysMu.Unlock()
+	progress, ok := w.keys[key]
+	if !ok {
+		return
+	}
+	for target := progress.submitted; progress.done < target; {
+		w.keysCond.Wait()
+	}
+}
+
+// pending returns the number of queued writes.
+func (w *asyncWriter) pending() int {
+	n := 0
+	for _, q := range w.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// close stops accepting writes and waits for the queued ones to be executed.
+func (w *asyncWriter) close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		for _, q := range w.queues {
+			close(q)
+		}
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
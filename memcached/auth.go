@@ -0,0 +1,132 @@
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator verifies credentials of clients. When a Server has an Authenticator set,
+// clients have to authenticate before issuing any other command, following the memcached
+// text protocol convention of sending a "set" command with "<username> <password>" as data.
+// Binary protocol clients authenticate with the SASL PLAIN mechanism.
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) (bool, error)
+}
+
+// authenticate handles a "set" command sent by an unauthenticated client.
+func (c *conn) authenticate(line []byte) error {
+	cmd, err := parseStorageLine(line)
+	if err != nil {
+		return err
+	}
+	if cmd.Name != CmdSet {
+		return Unauthenticated
+	}
+	if cmd.Length > sizeOrDefault(c.server.MaxItemSize, DefaultMaxItemSize) {
+		if _, err := io.CopyN(io.Discard, c.rwc, int64(cmd.Length)+2); err != nil {
+			return io.EOF
+		}
+		return ObjectTooLarge
+	}
+	data := make([]byte, cmd.Length+len(crlf))
+	if _, err := c.Read(data); err != nil {
+		return Error
+	}
+	if !bytes.HasSuffix(data, crlf) {
+		return BadDataChunk
+	}
+
+	c.server.Stats.AuthCmds.Increment(1)
+	credentials := strings.Fields(string(data[:cmd.Length]))
+	if len(credentials) != 2 {
+		c.server.Stats.AuthErrors.Increment(1)
+		return AuthenticationFailure
+	}
+	ok, err := c.server.Authenticator.Authenticate(c.ctx, credentials[0], credentials[1])
+	if err != nil || !ok {
+		c.server.Stats.AuthErrors.Increment(1)
+		return AuthenticationFailure
+	}
+	c.client.User = credentials[0]
+	c.rwc.WriteString(StatusStored)
+	return nil
+}
+
+// FileAuthenticator authenticates clients against a file with one "<username>:<password>"
+// pair per line, as used by memcached. The file is re-read when it changes.
+type FileAuthenticator struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	users   map[string]string
+}
+
+// NewFileAuthenticator creates a FileAuthenticator reading credentials from the file.
+func NewFileAuthenticator(path string) (*FileAuthenticator, error) {
+	a := &FileAuthenticator{path: path}
+	if _, err := a.credentials(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *FileAuthenticator) Authenticate(_ context.Context, username, password string) (bool, error) {
+	users, err := a.credentials()
+	if err != nil {
+		return false, err
+	}
+	expected, ok := users[username]
+	if !ok {
+		return false, nil
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1, nil
+}
+
+// credentials returns the credentials, reloading them first if the file changed.
+// If the file cannot be read, the previously loaded credentials are used.
+func (a *FileAuthenticator) credentials() (map[string]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fi, err := os.Stat(a.path)
+	if err == nil && (a.users == nil || fi.ModTime().After(a.modTime)) {
+		var users map[string]string
+		if users, err = readCredentials(a.path); err == nil {
+			a.users, a.modTime = users, fi.ModTime()
+		}
+	}
+	if a.users == nil {
+		return nil, err
+	}
+	return a.users, nil
+}
+
+func readCredentials(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, password, ok := strings.Cut(line, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("%s:%d: expected <username>:<password>", path, n)
+		}
+		users[username] = password
+	}
+	return users, scanner.Err()
+}
@@ -0,0 +1,324 @@
+package memcached
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// Binary protocol magic bytes, a connection speaks the binary protocol when its first byte is binaryRequest.
+const (
+	binaryRequest   = 0x80
+	binaryResponse  = 0x81
+	binaryHeaderLen = 24
+)
+
+// Binary protocol opcodes served by the server, others are answered with binaryUnknownCommand.
+const (
+	opGet           = 0x00
+	opSet           = 0x01
+	opDelete        = 0x04
+	opQuit          = 0x07
+	opNoop          = 0x0a
+	opVersion       = 0x0b
+	opGetQ          = 0x09
+	opGetK          = 0x0c
+	opGetKQ         = 0x0d
+	opSetQ          = 0x11
+	opDeleteQ       = 0x14
+	opQuitQ         = 0x17
+	opSASLListMechs = 0x20
+	opSASLAuth      = 0x21
+	opSASLStep      = 0x22
+)
+
+// Binary protocol response statuses.
+const (
+	binaryNoError        = 0x0000
+	binaryKeyNotFound    = 0x0001
+	binaryKeyExists      = 0x0002
+	binaryValueTooLarge  = 0x0003
+	binaryInvalidArgs    = 0x0004
+	binaryNotStored      = 0x0005
+	binaryAuthError      = 0x0020
+	binaryUnknownCommand = 0x0081
+	binaryNotSupported   = 0x0083
+	binaryInternalError  = 0x0084
+)
+
+// saslMechanisms are the SASL mechanisms offered to binary protocol clients.
+const saslMechanisms = "PLAIN"
+
+// binaryHeader is the fixed size header of a binary protocol request.
+type binaryHeader struct {
+	opcode    byte
+	keyLen    int
+	extrasLen int
+	bodyLen   int
+	opaque    uint32
+	cas       uint64
+}
+
+// isBinary checks whether the client speaks the binary protocol, judging by the first byte it sent.
+func (c *conn) isBinary() bool {
+	b, err := c.rwc.Reader.Peek(1)
+	return err == nil && b[0] == binaryRequest
+}
+
+// serveBinary serves requests of a binary protocol client until it quits or the connection fails.
+func (c *conn) serveBinary() {
+	for c.handleBinaryRequest() == nil {
+		// Like end, responses are flushed once the next request is not buffered.
+		if c.rwc.Reader.Buffered() < binaryHeaderLen {
+			c.rwc.Flush()
+		}
+	}
+}
+
+// handleBinaryRequest reads and answers a binary protocol request, an error means the connection has to be closed.
+func (c *conn) handleBinaryRequest() error {
+	setDeadline(c.conn.SetReadDeadline, c.server.IdleTimeout)
+	if c.server.closing.Load() {
+		return io.EOF
+	}
+	raw := make([]byte, binaryHeaderLen)
+	if _, err := io.ReadFull(c.rwc, raw); err != nil {
+		return io.EOF
+	}
+	setDeadline(c.conn.SetReadDeadline, c.server.ReadTimeout)
+	setDeadline(c.conn.SetWriteDeadline, c.server.WriteTimeout)
+	if raw[0] != binaryRequest {
+		// The request boundaries are lost, there is no way to continue.
+		return io.EOF
+	}
+	h := binaryHeader{
+		opcode:    raw[1],
+		keyLen:    int(binary.BigEndian.Uint16(raw[2:4])),
+		extrasLen: int(raw[4]),
+		bodyLen:   int(binary.BigEndian.Uint32(raw[8:12])),
+		opaque:    binary.BigEndian.Uint32(raw[12:16]),
+		cas:       binary.BigEndian.Uint64(raw[16:24]),
+	}
+
+	if h.bodyLen > sizeOrDefault(c.server.MaxItemSize, DefaultMaxItemSize)+MaxKeyLength+h.extrasLen {
+		// Swallow the body so that it is not interpreted as a request
+		if _, err := io.CopyN(io.Discard, c.rwc, int64(h.bodyLen)); err != nil {
+			return io.EOF
+		}
+		c.writeBinaryError(h, binaryValueTooLarge, "Too large")
+		return nil
+	}
+	body := make([]byte, h.bodyLen)
+	if _, err := c.Read(body); err != nil {
+		return io.EOF
+	}
+	if h.keyLen+h.extrasLen > h.bodyLen {
+		c.writeBinaryError(h, binaryInvalidArgs, "Invalid arguments")
+		return nil
+	}
+	extras := body[:h.extrasLen]
+	key := body[h.extrasLen : h.extrasLen+h.keyLen]
+	value := body[h.extrasLen+h.keyLen:]
+
+	switch h.opcode {
+	case opQuit:
+		c.writeBinary(h, binaryNoError, nil, nil, nil)
+		return io.EOF
+	case opQuitQ:
+		return io.EOF
+	case opNoop:
+		c.writeBinary(h, binaryNoError, nil, nil, nil)
+		return nil
+	case opVersion:
+		c.writeBinary(h, binaryNoError, nil, nil, []byte(VERSION))
+		return nil
+	case opSASLListMechs:
+		if c.server.Authenticator == nil {
+			c.writeBinaryError(h, binaryUnknownCommand, "Unknown command")
+			return nil
+		}
+		c.writeBinary(h, binaryNoError, nil, nil, []byte(saslMechanisms))
+		return nil
+	case opSASLAuth:
+		if c.server.Authenticator == nil {
+			c.writeBinaryError(h, binaryUnknownCommand, "Unknown command")
+			return nil
+		}
+		c.authenticateSASL(h, string(key), value)
+		return nil
+	case opSASLStep:
+		// PLAIN completes in a single step.
+		c.writeBinaryError(h, binaryAuthError, "Auth failure")
+		return nil
+	}
+
+	if c.server.Authenticator != nil && c.client.User == "" {
+		c.writeBinaryError(h, binaryAuthError, "Auth failure")
+		return nil
+	}
+	switch h.opcode {
+	case opGet, opGetQ, opGetK, opGetKQ:
+		if c.server.Getter == nil {
+			c.writeBinaryError(h, binaryUnknownCommand, "Unknown command")
+			return nil
+		}
+		if len(extras) != 0 || len(value) != 0 || !validKey(key) {
+			c.writeBinaryError(h, binaryInvalidArgs, "Invalid arguments")
+			return nil
+		}
+		c.binaryGet(h, string(key))
+	case opSet, opSetQ:
+		if c.server.Setter == nil {
+			c.writeBinaryError(h, binaryUnknownCommand, "Unknown command")
+			return nil
+		}
+		if len(extras) != 8 || !validKey(key) {
+			c.writeBinaryError(h, binaryInvalidArgs, "Invalid arguments")
+			return nil
+		}
+		if h.cas != 0 {
+			c.writeBinaryError(h, binaryNotSupported, "Not supported")
+			return nil
+		}
+		if c.server.ReadOnly() {
+			c.server.Stats.ReadOnlyRejected.Increment(1)
+			c.writeBinaryError(h, binaryInternalError, string(ReadOnlyMode))
+			return nil
+		}
+		item := &Item{
+			Key:   string(key),
+			Value: value,
+			Flags: int(binary.BigEndian.Uint32(extras[0:4])),
+		}
+		item.SetExpires(int64(binary.BigEndian.Uint32(extras[4:8])))
+		c.server.Stats.CMDSet.Increment(1)
+		c.server.asyncWrites().wait(item.Key)
+		status, message := binaryStatus(c.set(item))
+		if status != binaryNoError {
+			c.writeBinaryError(h, status, message)
+		} else if h.opcode == opSet {
+			c.writeBinary(h, binaryNoError, nil, nil, nil)
+		}
+	case opDelete, opDeleteQ:
+		if c.server.Deleter == nil {
+			c.writeBinaryError(h, binaryUnknownCommand, "Unknown command")
+			return nil
+		}
+		if len(extras) != 0 || len(value) != 0 || !validKey(key) {
+			c.writeBinaryError(h, binaryInvalidArgs, "Invalid arguments")
+			return nil
+		}
+		if c.server.ReadOnly() {
+			c.server.Stats.ReadOnlyRejected.Increment(1)
+			c.writeBinaryError(h, binaryInternalError, string(ReadOnlyMode))
+			return nil
+		}
+		c.server.asyncWrites().wait(string(key))
+		// As in the text protocol, any failure of a delete is reported as a missing key.
+		if response := c.delete(string(key)); response != nil {
+			c.writeBinaryError(h, binaryKeyNotFound, "Not found")
+		} else if h.opcode == opDelete {
+			c.writeBinary(h, binaryNoError, nil, nil, nil)
+		}
+	default:
+		c.writeBinaryError(h, binaryUnknownCommand, "Unknown command")
+	}
+	return nil
+}
+
+// binaryGet answers a get of the key, quiet gets are answered only when the key is found.
+func (c *conn) binaryGet(h binaryHeader, key string) {
+	c.server.Stats.CMDGet.Increment(1)
+	// Preceding noreply sets of the key are waited for, so that the get observes them.
+	c.server.asyncWrites().wait(key)
+	response := c.get(key)
+	if response == nil {
+		c.server.Stats.GetMisses.Increment(1)
+		if h.opcode == opGet || h.opcode == opGetK {
+			c.writeBinaryError(h, binaryKeyNotFound, "Not found")
+		}
+		return
+	}
+	ir, ok := response.(*ItemResponse)
+	if !ok {
+		status, message := binaryStatus(response)
+		c.writeBinaryError(h, status, message)
+		return
+	}
+	c.server.Stats.GetHits.Increment(1)
+	extras := make([]byte, 4)
+	binary.BigEndian.PutUint32(extras, uint32(ir.Item.Flags))
+	var k []byte
+	if h.opcode == opGetK || h.opcode == opGetKQ {
+		k = []byte(key)
+	}
+	c.writeBinary(h, binaryNoError, extras, k, ir.Item.Value)
+}
+
+// authenticateSASL handles a SASL_AUTH request, PLAIN data is "[authzid]\0<username>\0<password>".
+func (c *conn) authenticateSASL(h binaryHeader, mechanism string, data []byte) {
+	c.server.Stats.AuthCmds.Increment(1)
+	parts := bytes.Split(data, []byte{0})
+	if mechanism != saslMechanisms || len(parts) != 3 || len(parts[1]) == 0 {
+		c.server.Stats.AuthErrors.Increment(1)
+		c.writeBinaryError(h, binaryAuthError, "Auth failure")
+		return
+	}
+	username, password := string(parts[1]), string(parts[2])
+	ok, err := c.server.Authenticator.Authenticate(c.ctx, username, password)
+	if err != nil || !ok {
+		c.server.Stats.AuthErrors.Increment(1)
+		c.writeBinaryError(h, binaryAuthError, "Auth failure")
+		return
+	}
+	c.client.User = username
+	c.writeBinary(h, binaryNoError, nil, nil, []byte("Authenticated"))
+}
+
+// binaryStatus translates a handler response to a binary protocol status and message.
+func binaryStatus(response MemcachedResponse) (uint16, string) {
+	switch r := response.(type) {
+	case nil, *ItemResponse:
+		return binaryNoError, ""
+	case *ClientErrorResponse:
+		return binaryInvalidArgs, r.Reason
+	case *StatusResponse:
+		switch r.Status {
+		case StatusNotStored:
+			return binaryNotStored, "Not stored"
+		case StatusExists:
+			return binaryKeyExists, "Data exists for key"
+		case StatusNotFound:
+			return binaryKeyNotFound, "Not found"
+		}
+	}
+	var reason bytes.Buffer
+	response.WriteResponse(&reason)
+	message := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(reason.String()), "SERVER_ERROR"))
+	if message == "" {
+		message = "Internal error"
+	}
+	return binaryInternalError, message
+}
+
+// writeBinaryError writes an error response with the message as value.
+func (c *conn) writeBinaryError(h binaryHeader, status uint16, message string) {
+	c.writeBinary(h, status, nil, nil, []byte(message))
+}
+
+// writeBinary writes a binary protocol response to the request.
+func (c *conn) writeBinary(h binaryHeader, status uint16, extras, key, value []byte) {
+	header := make([]byte, binaryHeaderLen)
+	header[0] = binaryResponse
+	header[1] = h.opcode
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(key)))
+	header[4] = byte(len(extras))
+	binary.BigEndian.PutUint16(header[6:8], status)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(header[12:16], h.opaque)
+	c.rwc.Write(header)
+	c.rwc.Write(extras)
+	c.rwc.Write(key)
+	c.rwc.Write(value)
+}
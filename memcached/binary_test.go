@@ -0,0 +1,97 @@
+package memcached
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// sendBinary writes a binary protocol request.
+func (c *testClient) sendBinary(opcode byte, extras, key, value []byte) {
+	c.send(binaryRequestOf(opcode, extras, key, value))
+}
+
+// binaryRequestOf encodes a binary protocol request, its opaque is the opcode.
+func binaryRequestOf(opcode byte, extras, key, value []byte) string {
+	header := make([]byte, binaryHeaderLen)
+	header[0] = binaryRequest
+	header[1] = opcode
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(key)))
+	header[4] = byte(len(extras))
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(extras)+len(key)+len(value)))
+	binary.BigEndian.PutUint32(header[12:16], uint32(opcode))
+	request := append(header, extras...)
+	request = append(request, key...)
+	return string(append(request, value...))
+}
+
+// expectBinary reads a binary protocol response and checks its opcode, status and value.
+func (c *testClient) expectBinary(opcode byte, status uint16, value string) {
+	header := make([]byte, binaryHeaderLen)
+	_, err := io.ReadFull(c.r, header)
+	require.NoError(c.t, err)
+	require.Equal(c.t, byte(binaryResponse), header[0])
+	require.Equal(c.t, opcode, header[1])
+	require.Equal(c.t, status, binary.BigEndian.Uint16(header[6:8]))
+	require.Equal(c.t, uint32(opcode), binary.BigEndian.Uint32(header[12:16]))
+	body := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+	_, err = io.ReadFull(c.r, body)
+	require.NoError(c.t, err)
+	skip := int(header[4]) + int(binary.BigEndian.Uint16(header[2:4]))
+	require.Equal(c.t, value, string(body[skip:]))
+}
+
+func TestServer_Binary(t *testing.T) {
+	h := &orderedHandler{values: make(map[string][]string)}
+	c := serveConn(t, NewServer("", h))
+
+	c.sendBinary(opGet, nil, []byte("foo"), nil)
+	c.expectBinary(opGet, binaryKeyNotFound, "Not found")
+	c.sendBinary(opSet, make([]byte, 8), []byte("foo"), []byte("bar"))
+	c.expectBinary(opSet, binaryNoError, "")
+	c.sendBinary(opSetQ, make([]byte, 8), []byte("fail"), []byte("bar"))
+	c.expectBinary(opSetQ, binaryInternalError, "Internal error")
+	// Quiet commands are answered only on failure, noop flushes them.
+	c.send(binaryRequestOf(opSetQ, make([]byte, 8), []byte("foo"), []byte("baz")) +
+		binaryRequestOf(opGetQ, nil, []byte("missing"), nil) +
+		binaryRequestOf(opGetK, nil, []byte("foo"), nil) +
+		binaryRequestOf(opNoop, nil, nil, nil))
+	c.expectBinary(opGetK, binaryNoError, "baz")
+	c.expectBinary(opNoop, binaryNoError, "")
+	c.sendBinary(opDelete, nil, []byte("foo"), nil)
+	c.expectBinary(opDelete, binaryNoError, "")
+	c.sendBinary(opSASLListMechs, nil, nil, nil)
+	c.expectBinary(opSASLListMechs, binaryUnknownCommand, "Unknown command")
+	c.sendBinary(opQuit, nil, nil, nil)
+	c.expectBinary(opQuit, binaryNoError, "")
+	require.Equal(t, []string{"bar", "baz", "deleted"}, h.values["foo"])
+}
+
+func TestServer_BinaryAuthentication(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	require.NoError(t, os.WriteFile(path, []byte("service-a:secret\n"), 0o600))
+	auth, err := NewFileAuthenticator(path)
+	require.NoError(t, err)
+	h := newMapHandler()
+	h.items["foo"] = &Item{Key: "foo", Flags: 1, Value: []byte("bar")}
+	s := NewServer("", h)
+	s.Authenticator = auth
+	c := serveConn(t, s)
+
+	c.sendBinary(opGet, nil, []byte("foo"), nil)
+	c.expectBinary(opGet, binaryAuthError, "Auth failure")
+	c.sendBinary(opSASLListMechs, nil, nil, nil)
+	c.expectBinary(opSASLListMechs, binaryNoError, "PLAIN")
+	c.sendBinary(opSASLAuth, nil, []byte("PLAIN"), []byte("\x00service-a\x00secre7"))
+	c.expectBinary(opSASLAuth, binaryAuthError, "Auth failure")
+	c.sendBinary(opSASLAuth, nil, []byte("PLAIN"), []byte("\x00service-a\x00secret"))
+	c.expectBinary(opSASLAuth, binaryNoError, "Authenticated")
+	c.sendBinary(opGet, nil, []byte("foo"), nil)
+	c.expectBinary(opGet, binaryNoError, "bar")
+	require.Eventually(t, func() bool { return s.Stats.AuthErrors.String() == "1" }, time.Second, 10*time.Millisecond)
+}
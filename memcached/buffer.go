@@ -0,0 +1,49 @@
+package memcached
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+const (
+	// DefaultMaxItemSize is the maximum size of an item value unless configured otherwise.
+	DefaultMaxItemSize = 1024 * 1024
+	// DefaultReadBufferSize is the size of a connection read buffer unless configured otherwise.
+	DefaultReadBufferSize = 16 * 1024
+	// DefaultWriteBufferSize is the size of a connection write buffer unless configured otherwise.
+	DefaultWriteBufferSize = 16 * 1024
+)
+
+// bufferPool recycles connection buffers between connections so that
+// idle and short-lived connections do not allocate a fresh buffer each.
+type bufferPool struct {
+	readers sync.Pool
+	writers sync.Pool
+}
+
+func (p *bufferPool) getReader(r io.Reader, size int) *bufio.Reader {
+	if br, ok := p.readers.Get().(*bufio.Reader); ok && br.Size() == size {
+		br.Reset(r)
+		return br
+	}
+	return bufio.NewReaderSize(r, size)
+}
+
+func (p *bufferPool) putReader(br *bufio.Reader) {
+	br.Reset(nil)
+	p.readers.Put(br)
+}
+
+func (p *bufferPool) getWriter(w io.Writer, size int) *bufio.Writer {
+	if bw, ok := p.writers.Get().(*bufio.Writer); ok && bw.Size() == size {
+		bw.Reset(w)
+		return bw
+	}
+	return bufio.NewWriterSize(w, size)
+}
+
+func (p *bufferPool) putWriter(bw *bufio.Writer) {
+	bw.Reset(nil)
+	p.writers.Put(bw)
+}
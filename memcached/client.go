@@ -0,0 +1,40 @@
+package memcached
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// Client describes the client connection a request originates from.
+type Client struct {
+	// RemoteAddr is the address of the client.
+	RemoteAddr net.Addr
+	// TLS is the state of the TLS connection, nil for plaintext connections.
+	TLS *tls.ConnectionState
+	// User is the name the client authenticated with, empty if it did not authenticate.
+	User string
+}
+
+// Certificate returns the verified certificate the client presented
+// over mutual TLS or nil if there is none.
+func (c *Client) Certificate() *x509.Certificate {
+	if c.TLS == nil || len(c.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return c.TLS.VerifiedChains[0][0]
+}
+
+type clientKey struct{}
+
+// NewClientContext returns a new Context that carries the Client.
+func NewClientContext(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFromContext returns the Client stored in ctx, if any.
+func ClientFromContext(ctx context.Context) (*Client, bool) {
+	client, ok := ctx.Value(clientKey{}).(*Client)
+	return client, ok
+}
@@ -0,0 +1,111 @@
+package memcached
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+)
+
+// MaxKeyLength is the maximum length of a key in bytes as defined by the memcached protocol.
+const MaxKeyLength = 250
+
+// Storage command names as sent by the client.
+const (
+	CmdSet     = "set"
+	CmdAdd     = "add"
+	CmdReplace = "replace"
+	CmdAppend  = "append"
+	CmdPrepend = "prepend"
+	CmdCas     = "cas"
+)
+
+// StorageCmd is a parsed storage command line in the form
+// <command name> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply].
+type StorageCmd struct {
+	Name    string
+	Key     string
+	Flags   int
+	Exptime int64
+	Length  int
+	Cas     uint64
+	Noreply bool
+}
+
+// isStorageCmd checks whether the name is one of the storage commands.
+func isStorageCmd(name []byte) bool {
+	switch string(name) {
+	case CmdSet, CmdAdd, CmdReplace, CmdAppend, CmdPrepend, CmdCas:
+		return true
+	}
+	return false
+}
+
+// parseStorageLine parses a storage command line (without the trailing \r\n).
+// Error is returned when the command is not known or has a wrong number of fields,
+// BadCommandLineFormat is returned when any of the fields does not hold a valid value.
+func parseStorageLine(line []byte) (*StorageCmd, error) {
+	pieces := bytes.Fields(line)
+	if len(pieces) == 0 || !isStorageCmd(pieces[0]) {
+		return nil, Error
+	}
+	cmd := &StorageCmd{Name: string(pieces[0])}
+
+	// Number of mandatory fields including the command name.
+	fields := 5
+	if cmd.Name == CmdCas {
+		fields = 6
+	}
+	switch len(pieces) {
+	case fields:
+	case fields + 1:
+		if !bytes.Equal(pieces[fields], noreply) {
+			return nil, BadCommandLineFormat
+		}
+		cmd.Noreply = true
+	default:
+		return nil, Error
+	}
+
+	if !validKey(pieces[1]) {
+		return nil, BadCommandLineFormat
+	}
+	cmd.Key = string(pieces[1])
+
+	flags, err := strconv.ParseUint(string(pieces[2]), 10, 32)
+	if err != nil {
+		return nil, BadCommandLineFormat
+	}
+	cmd.Flags = int(flags)
+
+	cmd.Exptime, err = strconv.ParseInt(string(pieces[3]), 10, 64)
+	if err != nil {
+		return nil, BadCommandLineFormat
+	}
+
+	length, err := strconv.ParseUint(string(pieces[4]), 10, 32)
+	if err != nil || length > math.MaxInt32 {
+		return nil, BadCommandLineFormat
+	}
+	cmd.Length = int(length)
+
+	if cmd.Name == CmdCas {
+		cmd.Cas, err = strconv.ParseUint(string(pieces[5]), 10, 64)
+		if err != nil {
+			return nil, BadCommandLineFormat
+		}
+	}
+	return cmd, nil
+}
+
+// validKey checks the key is not empty, fits in MaxKeyLength and contains no whitespace or control characters.
+func validKey(key []byte) bool {
+	if len(key) == 0 || len(key) > MaxKeyLength {
+		return false
+	}
+	for _, b := range key {
+		if b <= ' ' || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
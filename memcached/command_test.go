@@ -0,0 +1,138 @@
+package memcached
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseStorageLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *StorageCmd
+		wantErr error
+	}{
+		{
+			name: "set",
+			line: "set foo 1 10 3",
+			want: &StorageCmd{Name: CmdSet, Key: "foo", Flags: 1, Exptime: 10, Length: 3},
+		},
+		{
+			name: "set noreply",
+			line: "set foo 0 0 3 noreply",
+			want: &StorageCmd{Name: CmdSet, Key: "foo", Length: 3, Noreply: true},
+		},
+		{
+			name: "negative exptime",
+			line: "add foo 0 -1 0",
+			want: &StorageCmd{Name: CmdAdd, Key: "foo", Exptime: -1},
+		},
+		{
+			name: "max flags",
+			line: "replace foo 4294967295 0 1",
+			want: &StorageCmd{Name: CmdReplace, Key: "foo", Flags: 4294967295, Length: 1},
+		},
+		{
+			name: "cas",
+			line: "cas foo 0 0 3 42 noreply",
+			want: &StorageCmd{Name: CmdCas, Key: "foo", Length: 3, Cas: 42, Noreply: true},
+		},
+		{
+			name:    "unknown command",
+			line:    "sets foo 0 0 3",
+			wantErr: Error,
+		},
+		{
+			name:    "too few fields",
+			line:    "set foo 0 0",
+			wantErr: Error,
+		},
+		{
+			name:    "too many fields",
+			line:    "set foo 0 0 3 noreply extra",
+			wantErr: Error,
+		},
+		{
+			name:    "cas without unique",
+			line:    "cas foo 0 0 3",
+			wantErr: Error,
+		},
+		{
+			name:    "bad noreply",
+			line:    "set foo 0 0 3 reply",
+			wantErr: BadCommandLineFormat,
+		},
+		{
+			name:    "key too long",
+			line:    "set " + strings.Repeat("k", MaxKeyLength+1) + " 0 0 3",
+			wantErr: BadCommandLineFormat,
+		},
+		{
+			name: "key of max length",
+			line: "set " + strings.Repeat("k", MaxKeyLength) + " 0 0 3",
+			want: &StorageCmd{Name: CmdSet, Key: strings.Repeat("k", MaxKeyLength), Length: 3},
+		},
+		{
+			name:    "key with control character",
+			line:    "set fo\x01o 0 0 3",
+			wantErr: BadCommandLineFormat,
+		},
+		{
+			name:    "negative flags",
+			line:    "set foo -1 0 3",
+			wantErr: BadCommandLineFormat,
+		},
+		{
+			name:    "flags overflow",
+			line:    "set foo 4294967296 0 3",
+			wantErr: BadCommandLineFormat,
+		},
+		{
+			name:    "bad exptime",
+			line:    "set foo 0 never 3",
+			wantErr: BadCommandLineFormat,
+		},
+		{
+			name:    "negative length",
+			line:    "set foo 0 0 -3",
+			wantErr: BadCommandLineFormat,
+		},
+		{
+			name:    "length overflow",
+			line:    "set foo 0 0 2147483648",
+			wantErr: BadCommandLineFormat,
+		},
+		{
+			name:    "bad cas unique",
+			line:    "cas foo 0 0 3 -1",
+			wantErr: BadCommandLineFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStorageLine([]byte(tt.line))
+			require.Equal(t, tt.wantErr, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func FuzzParseStorageLine(f *testing.F) {
+	f.Add([]byte("set foo 0 0 3"))
+	f.Add([]byte("set foo 0 0 3 noreply"))
+	f.Add([]byte("cas foo 1 -1 3 42"))
+	f.Add([]byte("append foo"))
+	f.Add([]byte("set"))
+	f.Fuzz(func(t *testing.T, line []byte) {
+		cmd, err := parseStorageLine(line)
+		if err != nil {
+			require.Nil(t, cmd)
+			return
+		}
+		require.True(t, validKey([]byte(cmd.Key)))
+		require.GreaterOrEqual(t, cmd.Flags, 0)
+		require.GreaterOrEqual(t, cmd.Length, 0)
+	})
+}
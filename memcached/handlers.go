@@ -1,5 +1,7 @@
 package memcached
 
+import "context"
+
 type RequestHandler interface{}
 
 // A Getter is an object who responds to a simple
@@ -22,3 +24,62 @@ type Deleter interface {
 	RequestHandler
 	Delete(string) MemcachedResponse
 }
+
+// A Scanner is an object who responds to the "scan"
+// extension command with multiple items.
+type Scanner interface {
+	RequestHandler
+	Scan(*ScanCmd) MemcachedResponse
+}
+
+// A ContextGetter is a Getter which receives the request context.
+// The context carries the Client the request originates from.
+type ContextGetter interface {
+	GetContext(context.Context, string) MemcachedResponse
+}
+
+// A ContextSetter is a Setter which receives the request context.
+// The context carries the Client the request originates from.
+type ContextSetter interface {
+	SetContext(context.Context, *Item) MemcachedResponse
+}
+
+// A ContextDeleter is a Deleter which receives the request context.
+// The context carries the Client the request originates from.
+type ContextDeleter interface {
+	DeleteContext(context.Context, string) MemcachedResponse
+}
+
+// A ContextScanner is a Scanner which receives the request context.
+// The context carries the Client the request originates from.
+type ContextScanner interface {
+	ScanContext(context.Context, *ScanCmd) MemcachedResponse
+}
+
+func (c *conn) get(key string) MemcachedResponse {
+	if g, ok := c.server.Getter.(ContextGetter); ok {
+		return g.GetContext(c.ctx, key)
+	}
+	return c.server.Getter.Get(key)
+}
+
+func (c *conn) set(item *Item) MemcachedResponse {
+	if s, ok := c.server.Setter.(ContextSetter); ok {
+		return s.SetContext(c.ctx, item)
+	}
+	return c.server.Setter.Set(item)
+}
+
+func (c *conn) delete(key string) MemcachedResponse {
+	if d, ok := c.server.Deleter.(ContextDeleter); ok {
+		return d.DeleteContext(c.ctx, key)
+	}
+	return c.server.Deleter.Delete(key)
+}
+
+func (c *conn) scan(cmd *ScanCmd) MemcachedResponse {
+	if s, ok := c.server.Scanner.(ContextScanner); ok {
+		return s.ScanContext(c.ctx, cmd)
+	}
+	return c.server.Scanner.Scan(cmd)
+}
@@ -38,3 +38,12 @@ type ClientErrorResponse struct {
 func (r *ClientErrorResponse) WriteResponse(writer io.Writer) {
 	fmt.Fprintf(writer, StatusClientError, r.Reason)
 }
+
+// StatusResponse writes a bare status line such as StatusNotStored.
+type StatusResponse struct {
+	Status string
+}
+
+func (r *StatusResponse) WriteResponse(writer io.Writer) {
+	io.WriteString(writer, r.Status)
+}
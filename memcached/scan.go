@@ -0,0 +1,86 @@
+package memcached
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// DefaultMaxScanLimit is the default maximum number of items returned by a scan command.
+const DefaultMaxScanLimit = 100
+
+// Scan command kinds.
+const (
+	ScanPrefix = "prefix"
+	ScanRange  = "range"
+)
+
+// ScanCmd is a parsed scan extension command line in one of the forms
+// scan prefix <prefix> [<limit>] and scan range <from> <to> [<limit>].
+// The range is inclusive, items are returned ordered by key.
+type ScanCmd struct {
+	Kind   string
+	Prefix string
+	From   string
+	To     string
+	Limit  int
+}
+
+// parseScanLine parses a scan command line (without the trailing \r\n).
+// A missing or zero limit is set to maxLimit, larger limits are lowered to it.
+func parseScanLine(line []byte, maxLimit int) (*ScanCmd, error) {
+	pieces := bytes.Fields(line)
+	if len(pieces) < 3 || string(pieces[0]) != "scan" {
+		return nil, Error
+	}
+	cmd := &ScanCmd{Kind: string(pieces[1])}
+	var keys int
+	switch cmd.Kind {
+	case ScanPrefix:
+		keys = 1
+	case ScanRange:
+		keys = 2
+	default:
+		return nil, Error
+	}
+	if len(pieces) != 2+keys && len(pieces) != 3+keys {
+		return nil, Error
+	}
+	for _, key := range pieces[2 : 2+keys] {
+		if !validKey(key) {
+			return nil, BadCommandLineFormat
+		}
+	}
+	if cmd.Kind == ScanPrefix {
+		cmd.Prefix = string(pieces[2])
+	} else {
+		cmd.From, cmd.To = string(pieces[2]), string(pieces[3])
+	}
+	if len(pieces) == 3+keys {
+		limit, err := strconv.Atoi(string(pieces[2+keys]))
+		if err != nil || limit < 0 {
+			return nil, BadCommandLineFormat
+		}
+		cmd.Limit = limit
+	}
+	if cmd.Limit == 0 || cmd.Limit > maxLimit {
+		cmd.Limit = maxLimit
+	}
+	return cmd, nil
+}
+
+// handleScan handles the "scan" extension command, responding with the items found followed by END.
+func (c *conn) handleScan(line []byte) error {
+	if c.server.Scanner == nil {
+		return Error
+	}
+	cmd, err := parseScanLine(line, sizeOrDefault(c.server.MaxScanLimit, DefaultMaxScanLimit))
+	if err != nil {
+		return err
+	}
+	c.server.Stats.CMDScan.Increment(1)
+	if response := c.scan(cmd); response != nil {
+		response.WriteResponse(c.rwc)
+	}
+	c.rwc.WriteString(StatusEnd)
+	return nil
+}
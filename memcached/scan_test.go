@@ -0,0 +1,34 @@
+package memcached
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScanLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    *ScanCmd
+		wantErr error
+	}{
+		{line: "scan prefix foo:", want: &ScanCmd{Kind: ScanPrefix, Prefix: "foo:", Limit: 100}},
+		{line: "scan prefix foo: 10", want: &ScanCmd{Kind: ScanPrefix, Prefix: "foo:", Limit: 10}},
+		{line: "scan prefix foo: 1000", want: &ScanCmd{Kind: ScanPrefix, Prefix: "foo:", Limit: 100}},
+		{line: "scan range a b 0", want: &ScanCmd{Kind: ScanRange, From: "a", To: "b", Limit: 100}},
+		{line: "scan range a b 5", want: &ScanCmd{Kind: ScanRange, From: "a", To: "b", Limit: 5}},
+		{line: "scan range a", wantErr: Error},
+		{line: "scan prefix a b c", wantErr: Error},
+		{line: "scan keys a", wantErr: Error},
+		{line: "scan", wantErr: Error},
+		{line: "scan prefix a -1", wantErr: BadCommandLineFormat},
+		{line: "scan prefix a\x01", wantErr: BadCommandLineFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := parseScanLine([]byte(tt.line), DefaultMaxScanLimit)
+			require.Equal(t, tt.wantErr, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
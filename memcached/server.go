@@ -5,106 +5,467 @@ package memcached
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
-	"strconv"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const VERSION = "0.0.0"
 
+// DefaultMaxPipelineDepth is the default number of gets a connection looks up concurrently.
+const DefaultMaxPipelineDepth = 16
+
 var (
 	crlf    = []byte("\r\n")
 	noreply = []byte("noreply")
 )
 
+// ErrServerClosed is returned by Serve and ListenAndServe after Shutdown.
+var ErrServerClosed = errors.New("memcached: server closed")
+
 type conn struct {
 	server *Server
 	conn   net.Conn
 	rwc    *bufio.ReadWriter
+	client *Client
+	ctx    context.Context
+	// inflight are responses of pipelined gets in request order, see getAsync.
+	inflight []chan []byte
 }
 
 type Server struct {
-	Addr    string
+	// Addr is the TCP address to listen on. It defaults to ":11211" unless Socket is set.
+	Addr string
+	// Socket is the path of a Unix socket to listen on, alongside Addr if set.
+	Socket string
+	// SocketPerm are the permissions of the Socket file.
+	SocketPerm os.FileMode
+	// TLSConfig enables TLS on all listeners when set, see NewTLSConfig. The handshake is limited
+	// by ReadTimeout, IdleTimeout when unset, or DefaultHandshakeTimeout when neither is set.
+	TLSConfig *tls.Config
+	// Authenticator requires clients to authenticate before issuing commands when set.
+	Authenticator Authenticator
+	// AdminUsers are users allowed to issue administrative commands, e.g. "readonly on".
+	// When empty, everybody is allowed without an Authenticator and nobody with one.
+	AdminUsers []string
+
 	Getter  Getter
 	Setter  Setter
 	Deleter Deleter
+	Scanner Scanner
 	Stats   Stats
-}
 
-type StorageCmd struct {
-	Key     string
-	Flags   int
-	Exptime int64
-	Length  int
-	Noreply bool
+	// MaxItemSize is the maximum size of a value accepted by storage commands.
+	// Larger values are discarded and answered with SERVER_ERROR. Defaults to DefaultMaxItemSize.
+	MaxItemSize int
+	// ReadBufferSize is the size of a per-connection read buffer. Defaults to DefaultReadBufferSize.
+	ReadBufferSize int
+	// WriteBufferSize is the size of a per-connection write buffer. Defaults to DefaultWriteBufferSize.
+	WriteBufferSize int
+
+	// MaxConnections is the maximum number of simultaneously served connections.
+	// Connections over the limit are answered with SERVER_ERROR and closed. Zero means no limit.
+	MaxConnections int
+	// IdleTimeout is the maximum amount of time to wait for the next command. Zero means no timeout.
+	IdleTimeout time.Duration
+	// ReadTimeout is the maximum amount of time to read the rest of a command once its line
+	// has been received, e.g. the data block of a storage command. Zero means no timeout.
+	ReadTimeout time.Duration
+	// WriteTimeout is the maximum amount of time to write a response. Zero means no timeout.
+	WriteTimeout time.Duration
+
+	// MaxPipelineDepth is the maximum number of gets a connection looks up concurrently when
+	// the client pipelines commands. Defaults to DefaultMaxPipelineDepth.
+	MaxPipelineDepth int
+
+	// MaxScanLimit is the maximum number of items returned by a scan command, larger limits
+	// are lowered to it. Defaults to DefaultMaxScanLimit.
+	MaxScanLimit int
+
+	// AsyncWriteConcurrency is the number of workers executing noreply sets, writes of a key
+	// are executed in order by the same worker. Other commands of a key wait for its queued
+	// noreply sets. Defaults to DefaultAsyncWriteConcurrency.
+	AsyncWriteConcurrency int
+	// AsyncWriteQueueSize is the number of noreply sets waiting for a worker, further sets
+	// block the connection until there is space. Defaults to DefaultAsyncWriteQueueSize.
+	AsyncWriteQueueSize int
+	// ErrorLog receives errors which cannot be reported to clients, e.g. failed noreply sets.
+	// The standard logger is used when nil.
+	ErrorLog *log.Logger
+
+	buffers  bufferPool
+	connMu   sync.Mutex
+	conns    int
+	readOnly atomic.Bool
+
+	writesOnce sync.Once
+	writes     *asyncWriter
+	// listeners and active connections are tracked for Shutdown.
+	listeners map[net.Listener]struct{}
+	active    map[*conn]struct{}
+	connWG    sync.WaitGroup
+	closing   atomic.Bool
 }
 
 func (s *Server) newConn(rwc net.Conn) (c *conn) {
 	c = new(conn)
 	c.server = s
 	c.conn = rwc
-	c.rwc = bufio.NewReadWriter(bufio.NewReaderSize(rwc, 1048576), bufio.NewWriter(rwc))
+	c.client = &Client{RemoteAddr: rwc.RemoteAddr()}
+	c.ctx = NewClientContext(context.Background(), c.client)
+	c.rwc = bufio.NewReadWriter(
+		s.buffers.getReader(rwc, sizeOrDefault(s.ReadBufferSize, DefaultReadBufferSize)),
+		s.buffers.getWriter(rwc, sizeOrDefault(s.WriteBufferSize, DefaultWriteBufferSize)),
+	)
 	return c
 }
 
-// ListenAndServe starts listening and accepting requests to this server.
+func sizeOrDefault(size, def int) int {
+	if size <= 0 {
+		return def
+	}
+	return size
+}
+
+// ListenAndServe starts listening and accepting requests to this server
+// on the TCP address and the Unix socket. It returns once any of the listeners fails.
 func (s *Server) ListenAndServe() error {
-	addr := s.Addr
-	if addr == "" {
-		addr = ":11211"
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
 	}
-	l, e := net.Listen("tcp", addr)
-	if e != nil {
-		return e
+	if s.Addr != "" || s.Socket == "" {
+		addr := s.Addr
+		if addr == "" {
+			addr = ":11211"
+		}
+		l, e := net.Listen("tcp", addr)
+		if e != nil {
+			return e
+		}
+		listeners = append(listeners, l)
+	}
+	if s.Socket != "" {
+		l, e := listenUnix(s.Socket, s.SocketPerm)
+		if e != nil {
+			closeAll()
+			return e
+		}
+		listeners = append(listeners, l)
 	}
-	return s.Serve(l)
+	defer closeAll()
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- s.Serve(l)
+		}(l)
+	}
+	return <-errs
 }
 
+// Serve accepts connections on the listener, wrapping them in TLS if TLSConfig is set.
 func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
 	defer l.Close()
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
 	for {
 		rw, e := l.Accept()
 		if e != nil {
+			if s.closing.Load() {
+				return ErrServerClosed
+			}
 			return e
 		}
+		if !s.acquireConn() {
+			go s.reject(rw)
+			continue
+		}
 		c := s.newConn(rw)
 		go c.serve()
 	}
 }
 
+// trackListener adds or removes the listener from the ones closed by Shutdown.
+// Adding fails once the server is shutting down.
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.closing.Load() {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// Shutdown stops accepting connections, waits for the served requests to complete, closing
+// the connections once idle, and then for the queued noreply sets to be written.
+// It returns the context error if the context is done first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.connMu.Lock()
+	s.closing.Store(true)
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.active {
+		// Interrupt connections waiting for the next command, handleRequest stops serving
+		// connections which start reading a command after the server started closing.
+		_ = c.conn.SetReadDeadline(time.Now())
+	}
+	s.connMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.connWG.Wait()
+		s.asyncWrites().close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// asyncWrites returns the executor of noreply sets, which is started on the first use.
+func (s *Server) asyncWrites() *asyncWriter {
+	s.writesOnce.Do(func() {
+		s.writes = newAsyncWriter(
+			sizeOrDefault(s.AsyncWriteConcurrency, DefaultAsyncWriteConcurrency),
+			sizeOrDefault(s.AsyncWriteQueueSize, DefaultAsyncWriteQueueSize),
+		)
+	})
+	return s.writes
+}
+
+// setAsync queues a noreply set, failures are logged and counted as they cannot be reported to the client.
+func (c *conn) setAsync(item *Item) {
+	c.server.asyncWrites().submit(item.Key, func() {
+		response := c.set(item)
+		if response == nil {
+			return
+		}
+		var reason bytes.Buffer
+		response.WriteResponse(&reason)
+		c.server.Stats.AsyncWriteErrors.Increment(1)
+		c.server.logf("noreply set of %s failed: %s", item.Key, bytes.TrimSpace(reason.Bytes()))
+	})
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// acquireConn reserves a slot for a new connection, false is returned when MaxConnections has been reached.
+func (s *Server) acquireConn() bool {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if s.MaxConnections > 0 && s.conns >= s.MaxConnections {
+		return false
+	}
+	s.conns++
+	s.connWG.Add(1)
+	s.Stats.CurrConnections.SetCount(s.conns)
+	return true
+}
+
+// releaseConn frees a slot reserved by acquireConn.
+func (s *Server) releaseConn() {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	s.conns--
+	s.connWG.Done()
+	s.Stats.CurrConnections.SetCount(s.conns)
+}
+
+// trackConn adds or removes the connection from the ones interrupted by Shutdown.
+func (s *Server) trackConn(c *conn, add bool) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	if !add {
+		delete(s.active, c)
+		return
+	}
+	if s.active == nil {
+		s.active = make(map[*conn]struct{})
+	}
+	s.active[c] = struct{}{}
+}
+
+// reject tells the client the server is full and closes the connection.
+func (s *Server) reject(rw net.Conn) {
+	defer rw.Close()
+	s.Stats.RejectedConnections.Increment(1)
+	timeout := s.WriteTimeout
+	if timeout == 0 {
+		timeout = time.Second
+	}
+	_ = rw.SetWriteDeadline(time.Now().Add(timeout))
+	_, _ = io.WriteString(rw, TooManyConnections.Error())
+}
+
 func (c *conn) serve() {
+	c.server.trackConn(c, true)
 	defer func() {
-		c.server.Stats.CurrConnections.Decrement(1)
+		c.drain()
+		c.rwc.Flush()
+		c.server.trackConn(c, false)
 		c.Close()
+		c.server.releaseConn()
 	}()
 	c.server.Stats.TotalConnections.Increment(1)
-	c.server.Stats.CurrConnections.Increment(1)
+	if tc, ok := c.conn.(*tls.Conn); ok {
+		setDeadline(c.conn.SetDeadline, c.server.handshakeTimeout())
+		if err := tc.Handshake(); err != nil {
+			return
+		}
+		state := tc.ConnectionState()
+		c.client.TLS = &state
+	}
+	setDeadline(c.conn.SetReadDeadline, c.server.IdleTimeout)
+	if c.isBinary() {
+		c.serveBinary()
+		return
+	}
 	for {
 		err := c.handleRequest()
 		if err != nil {
 			if err == io.EOF {
 				return
 			}
+			c.drain()
 			c.rwc.WriteString(err.Error())
-			c.end()
 		}
+		c.end()
 	}
 }
 
+// end completes a command, including commands without a response. Responses are flushed
+// once the next command is not buffered, so that responses to pipelined commands are sent
+// together and no response waits for a read which would block.
 func (c *conn) end() {
+	if c.commandBuffered() {
+		return
+	}
+	c.drain()
 	c.rwc.Flush()
 }
 
+// commandBuffered checks whether a complete command line is buffered, so that reading it does not block.
+func (c *conn) commandBuffered() bool {
+	n := c.rwc.Reader.Buffered()
+	if n == 0 {
+		return false
+	}
+	buffered, _ := c.rwc.Reader.Peek(n)
+	return bytes.IndexByte(buffered, '\n') >= 0
+}
+
+// drain writes the responses of pipelined gets, waiting for the lookups to complete.
+func (c *conn) drain() {
+	for _, response := range c.inflight {
+		c.rwc.Write(<-response)
+	}
+	c.inflight = c.inflight[:0]
+}
+
+// getAsync looks the key up in the background, its response is written by drain in request order.
+func (c *conn) getAsync(key string) {
+	if len(c.inflight) >= sizeOrDefault(c.server.MaxPipelineDepth, DefaultMaxPipelineDepth) {
+		c.drain()
+	}
+	response := make(chan []byte, 1)
+	c.inflight = append(c.inflight, response)
+	go func() {
+		var buf bytes.Buffer
+		c.writeGet(&buf, key)
+		response <- buf.Bytes()
+	}()
+}
+
+// writeGet writes the response to a get of the key.
+// Preceding noreply sets of the key are waited for, so that the get observes them.
+func (c *conn) writeGet(w io.Writer, key string) {
+	c.server.asyncWrites().wait(key)
+	response := c.get(key)
+	if response != nil {
+		c.server.Stats.GetHits.Increment(1)
+		response.WriteResponse(w)
+	} else {
+		c.server.Stats.GetMisses.Increment(1)
+	}
+	io.WriteString(w, StatusEnd)
+}
+
+// setDeadline sets the connection deadline given by timeout, zero timeout clears the deadline.
+func setDeadline(set func(time.Time) error, timeout time.Duration) {
+	var t time.Time
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	_ = set(t)
+}
+
 func (c *conn) handleRequest() error {
+	setDeadline(c.conn.SetReadDeadline, c.server.IdleTimeout)
+	if c.server.closing.Load() {
+		return io.EOF
+	}
 	line, err := c.ReadLine()
+	if err == LineTooLong {
+		return err
+	}
 	if err != nil || len(line) == 0 {
 		return io.EOF
 	}
+	setDeadline(c.conn.SetReadDeadline, c.server.ReadTimeout)
+	setDeadline(c.conn.SetWriteDeadline, c.server.WriteTimeout)
+	if c.server.Authenticator != nil && c.client.User == "" {
+		switch {
+		case bytes.HasPrefix(line, []byte("set ")):
+			return c.authenticate(line)
+		case string(line) == "quit":
+			return io.EOF
+		default:
+			return Unauthenticated
+		}
+	}
 	if len(line) < 4 {
 		return Error
 	}
+	if line[0] != 'g' {
+		// Only gets are pipelined, other commands respond after the preceding gets.
+		c.drain()
+	}
 	switch line[0] {
 	case 'g':
 		f := strings.Fields(string(line))
@@ -117,69 +478,71 @@ func (c *conn) handleRequest() error {
 			return Error
 		}
 		c.server.Stats.CMDGet.Increment(1)
-		response := c.server.Getter.Get(key)
-		if response != nil {
-			c.server.Stats.GetHits.Increment(1)
-			response.WriteResponse(c.rwc)
-		} else {
-			c.server.Stats.GetMisses.Increment(1)
+		if c.commandBuffered() {
+			// More commands are pipelined, look the key up while they are read.
+			c.getAsync(key)
+			return nil
 		}
-		c.rwc.WriteString(StatusEnd)
-		c.end()
+		c.drain()
+		c.writeGet(c.rwc, key)
 	case 's':
 		switch line[1] {
 		case 'e':
-			if len(line) < 11 {
-				return Error
-			}
 			if c.server.Setter == nil {
 				return Error
 			}
+			cmd, err := parseStorageLine(line)
+			if err != nil {
+				return err
+			}
 			item := &Item{}
-			cmd := parseStorageLine(line)
 			item.Key = cmd.Key
 			item.Flags = cmd.Flags
 			item.SetExpires(cmd.Exptime)
 
-			value := make([]byte, cmd.Length+2)
-			n, err := c.Read(value)
-			if err != nil {
-				return Error
+			if cmd.Length > sizeOrDefault(c.server.MaxItemSize, DefaultMaxItemSize) {
+				// Swallow the data block so that it is not interpreted as a command
+				if _, err := io.CopyN(io.Discard, c.rwc, int64(cmd.Length)+2); err != nil {
+					return io.EOF
+				}
+				return ObjectTooLarge
 			}
 
-			// Didn't provide the correct number of bytes
-			if n != cmd.Length+2 {
-				response := &ClientErrorResponse{"bad chunk data"}
-				response.WriteResponse(c.rwc)
-				c.ReadLine() // Read out the rest of the line
+			item.Value = make([]byte, cmd.Length)
+			if _, err := c.Read(item.Value); err != nil {
 				return Error
 			}
 
 			// Doesn't end with \r\n
-			if !bytes.HasSuffix(value, crlf) {
-				response := &ClientErrorResponse{"bad chunk data"}
-				response.WriteResponse(c.rwc)
+			end := make([]byte, len(crlf))
+			if _, err := c.Read(end); err != nil || !bytes.Equal(end, crlf) {
 				c.ReadLine() // Read out the rest of the line
-				return Error
+				return BadDataChunk
 			}
 
-			// Copy the value into the *Item
-			item.Value = make([]byte, len(value)-2)
-			copy(item.Value, value)
-
+			if c.server.ReadOnly() {
+				c.server.Stats.ReadOnlyRejected.Increment(1)
+				if cmd.Noreply {
+					c.server.logf("noreply set of %s dropped in read-only mode", item.Key)
+					return nil
+				}
+				return ReadOnlyMode
+			}
 			c.server.Stats.CMDSet.Increment(1)
 			if cmd.Noreply {
-				go c.server.Setter.Set(item)
+				c.setAsync(item)
 			} else {
-				response := c.server.Setter.Set(item)
+				// Wait for preceding noreply sets of the key, so that the set does not overtake them.
+				c.server.asyncWrites().wait(item.Key)
+				response := c.set(item)
 				if response != nil {
 					response.WriteResponse(c.rwc)
-					c.end()
 				} else {
 					c.rwc.WriteString(StatusStored)
-					c.end()
 				}
 			}
+		case 'c':
+			return c.handleScan(line)
 		case 't':
 			if len(line) != 5 {
 				return Error
@@ -188,7 +551,6 @@ func (c *conn) handleRequest() error {
 				fmt.Fprintf(c.rwc, StatusStat, key, value)
 			}
 			c.rwc.WriteString(StatusEnd)
-			c.end()
 		default:
 			return Error
 		}
@@ -200,20 +562,23 @@ func (c *conn) handleRequest() error {
 		if c.server.Deleter == nil {
 			return Error
 		}
-		err := c.server.Deleter.Delete(key)
-		if err != nil {
+		if c.server.ReadOnly() {
+			c.server.Stats.ReadOnlyRejected.Increment(1)
+			return ReadOnlyMode
+		}
+		c.server.asyncWrites().wait(key)
+		if response := c.delete(key); response != nil {
 			c.rwc.WriteString(StatusNotFound)
-			c.end()
 		} else {
 			c.rwc.WriteString(StatusDeleted)
-			c.end()
 		}
+	case 'r':
+		return c.handleReadOnly(line)
 	case 'v':
 		if len(line) != 7 {
 			return Error
 		}
 		c.rwc.WriteString(fmt.Sprintf(StatusVersion, VERSION))
-		c.end()
 	case 'q':
 		if len(line) == 4 {
 			return io.EOF
@@ -227,33 +592,52 @@ func (c *conn) handleRequest() error {
 
 func (c *conn) Close() {
 	c.conn.Close()
+	c.server.buffers.putReader(c.rwc.Reader)
+	c.server.buffers.putWriter(c.rwc.Writer)
 }
 
 func (c *conn) ReadLine() (line []byte, err error) {
-	line, _, err = c.rwc.ReadLine()
+	line, isPrefix, err := c.rwc.ReadLine()
+	if isPrefix {
+		// Discard the rest of a line which does not fit into the read buffer
+		for isPrefix && err == nil {
+			_, isPrefix, err = c.rwc.ReadLine()
+		}
+		if err == nil {
+			err = LineTooLong
+		}
+		return nil, err
+	}
 	return
 }
 
 func (c *conn) Read(p []byte) (n int, err error) {
+	if c.rwc.Reader.Buffered() < len(p) {
+		// Send responses to preceding commands before waiting for the rest of the data.
+		c.rwc.Flush()
+	}
 	return io.ReadFull(c.rwc, p)
 }
 
-func parseStorageLine(line []byte) *StorageCmd {
-	pieces := bytes.Fields(line[4:]) // Skip the actual "set "
-	cmd := &StorageCmd{}
-	// lol, no error handling here
-	cmd.Key = string(pieces[0])
-	cmd.Flags, _ = strconv.Atoi(string(pieces[1]))
-	cmd.Exptime, _ = strconv.ParseInt(string(pieces[2]), 10, 64)
-	cmd.Length, _ = strconv.Atoi(string(pieces[3]))
-	cmd.Noreply = len(pieces) == 5 && bytes.Equal(pieces[4], noreply)
-	return cmd
-}
-
 // NewServer initialize a new memcached Server.
 func NewServer(listen string, handler RequestHandler) *Server {
 	getter, _ := handler.(Getter)
 	setter, _ := handler.(Setter)
 	deleter, _ := handler.(Deleter)
-	return &Server{listen, getter, setter, deleter, NewStats()}
+	scanner, _ := handler.(Scanner)
+	s := &Server{
+		Addr:    listen,
+		Getter:  getter,
+		Setter:  setter,
+		Deleter: deleter,
+		Scanner: scanner,
+		Stats:   NewStats(),
+	}
+	s.Stats.ReadOnly = &FuncStat{func() string {
+		if s.ReadOnly() {
+			return "1"
+		}
+		return "0"
+	}}
+	return s
 }
@@ -0,0 +1,468 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mapHandler struct {
+	mu    sync.Mutex
+	items map[string]*Item
+}
+
+func (h *mapHandler) Get(key string) MemcachedResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if item, ok := h.items[key]; ok {
+		return &ItemResponse{Item: item}
+	}
+	return nil
+}
+
+func (h *mapHandler) Set(item *Item) MemcachedResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.items[item.Key] = item
+	return nil
+}
+
+func (h *mapHandler) Scan(cmd *ScanCmd) MemcachedResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.items))
+	for key := range h.items {
+		if cmd.Kind == ScanPrefix && strings.HasPrefix(key, cmd.Prefix) || cmd.Kind == ScanRange && key >= cmd.From && key <= cmd.To {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	response := &BulkResponse{}
+	for i, key := range keys {
+		if i == cmd.Limit {
+			break
+		}
+		response.Responses = append(response.Responses, &ItemResponse{Item: h.items[key]})
+	}
+	return response
+}
+
+// orderedHandler records the values of sets by key and fails sets of the key "fail".
+type orderedHandler struct {
+	mu     sync.Mutex
+	values map[string][]string
+}
+
+func (h *orderedHandler) Set(item *Item) MemcachedResponse {
+	if item.Key == "fail" {
+		return &StatusResponse{Status: StatusServerError}
+	}
+	if string(item.Value) == "slow" {
+		time.Sleep(50 * time.Millisecond)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.values[item.Key] = append(h.values[item.Key], string(item.Value))
+	return nil
+}
+
+func (h *orderedHandler) Get(key string) MemcachedResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	values := h.values[key]
+	if len(values) == 0 {
+		return nil
+	}
+	return &ItemResponse{Item: &Item{Key: key, Value: []byte(values[len(values)-1])}}
+}
+
+func (h *orderedHandler) Delete(key string) MemcachedResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.values[key] = append(h.values[key], "deleted")
+	return nil
+}
+
+func newMapHandler() *mapHandler {
+	return &mapHandler{items: make(map[string]*Item)}
+}
+
+// testClient is a client end of a connection served by a Server.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *testClient) send(s string) {
+	_, err := c.conn.Write([]byte(s))
+	require.NoError(c.t, err)
+}
+
+func (c *testClient) expect(lines ...string) {
+	for _, line := range lines {
+		got, err := c.r.ReadString('\n')
+		require.NoError(c.t, err)
+		require.Equal(c.t, line, strings.TrimSuffix(got, "\r\n"))
+	}
+}
+
+func serveConn(t *testing.T, s *Server) *testClient {
+	client, server := net.Pipe()
+	require.True(t, s.acquireConn())
+	go s.newConn(server).serve()
+	t.Cleanup(func() { client.Close() })
+	return &testClient{t: t, conn: client, r: bufio.NewReader(client)}
+}
+
+func TestServer_Set(t *testing.T) {
+	h := newMapHandler()
+	s := NewServer("", h)
+	c := serveConn(t, s)
+
+	c.send("set foo 5 0 3\r\nbar\r\n")
+	c.expect("STORED")
+	c.send("get foo\r\n")
+	c.expect("VALUE foo 5 3", "bar", "END")
+
+	c.send("set foo 0 0 3\r\nbarbaz\r\n")
+	c.expect("CLIENT_ERROR bad data chunk")
+
+	c.send("set foo 0 0 -1\r\n")
+	c.expect("CLIENT_ERROR bad command line format")
+
+	c.send("set foo 0 0\r\n")
+	c.expect("ERROR")
+}
+
+func TestServer_MaxItemSize(t *testing.T) {
+	h := newMapHandler()
+	s := NewServer("", h)
+	s.MaxItemSize = 4
+	c := serveConn(t, s)
+
+	c.send("set foo 0 0 5\r\ntoolo\r\n")
+	c.expect("SERVER_ERROR object too large for cache")
+	// The data block has been swallowed and the connection is still usable.
+	c.send("set foo 0 0 4\r\nfits\r\n")
+	c.expect("STORED")
+}
+
+func TestServer_LineTooLong(t *testing.T) {
+	s := NewServer("", newMapHandler())
+	s.ReadBufferSize = 16
+	c := serveConn(t, s)
+
+	c.send("get " + strings.Repeat("k", 64) + "\r\n")
+	c.expect("CLIENT_ERROR line too long")
+	c.send("version\r\n")
+	c.expect("VERSION " + VERSION)
+}
+
+func TestServer_MaxConnections(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewServer("", newMapHandler())
+	s.MaxConnections = 1
+	go s.Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	first, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	c := &testClient{t: t, conn: first, r: bufio.NewReader(first)}
+	c.send("version\r\n")
+	c.expect("VERSION " + VERSION)
+
+	second, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	rejected := &testClient{t: t, conn: second, r: bufio.NewReader(second)}
+	rejected.expect("SERVER_ERROR too many open connections")
+	require.Eventually(t, func() bool { return s.Stats.RejectedConnections.String() == "1" }, time.Second, 10*time.Millisecond)
+	require.Equal(t, "1", s.Stats.CurrConnections.String())
+
+	first.Close()
+	require.Eventually(t, func() bool { return s.Stats.CurrConnections.String() == "0" }, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_SetNoreply(t *testing.T) {
+	h := &orderedHandler{values: make(map[string][]string)}
+	s := NewServer("", h)
+	s.AsyncWriteConcurrency = 4
+	s.AsyncWriteQueueSize = 4
+	c := serveConn(t, s)
+
+	var want []string
+	for i := 0; i < 100; i++ {
+		v := strconv.Itoa(i)
+		want = append(want, v)
+		c.send(fmt.Sprintf("set foo 0 0 %d noreply\r\n%s\r\n", len(v), v))
+	}
+	c.send("set fail 0 0 1 noreply\r\nx\r\n")
+	c.send("version\r\n")
+	c.expect("VERSION " + VERSION)
+
+	// Shutdown closes the idle connection and drains the queued sets.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+	_, err := c.r.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, want, h.values["foo"])
+	require.Eventually(t, func() bool { return s.Stats.AsyncWriteErrors.String() == "1" }, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_SetNoreplyOrder(t *testing.T) {
+	h := &orderedHandler{values: make(map[string][]string)}
+	s := NewServer("", h)
+	c := serveConn(t, s)
+
+	c.send("set k 0 0 4 noreply\r\nslow\r\n")
+	c.send("set k 0 0 3\r\nnew\r\n")
+	c.expect("STORED")
+	c.send("set k 0 0 4 noreply\r\nslow\r\n")
+	c.send("delete k\r\n")
+	c.expect("DELETED")
+	c.send("set g 0 0 4 noreply\r\nslow\r\n")
+	c.send("get g\r\n")
+	c.expect("VALUE g 0 4", "slow", "END")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	require.Equal(t, []string{"slow", "new", "slow", "deleted"}, h.values["k"])
+}
+
+func TestServer_SetNoreplyOtherKeys(t *testing.T) {
+	h := &orderedHandler{values: make(map[string][]string)}
+	s := NewServer("", h)
+	s.AsyncWriteConcurrency = 1
+	a, b := serveConn(t, s), serveConn(t, s)
+
+	// The only worker is busy with a slow set, writes of other keys do not wait for it.
+	a.send("set k 0 0 4 noreply\r\nslow\r\n")
+	a.send("version\r\n")
+	a.expect("VERSION " + VERSION)
+	start := time.Now()
+	b.send("set other 0 0 1\r\nx\r\n")
+	b.expect("STORED")
+	require.Less(t, time.Since(start), 40*time.Millisecond)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewServer("", newMapHandler())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.send("version\r\n")
+	c.expect("VERSION " + VERSION)
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	require.ErrorIs(t, <-served, ErrServerClosed)
+	_, err = c.r.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+	require.ErrorIs(t, s.Serve(l), ErrServerClosed)
+}
+
+// slowHandler answers gets after a delay given by the key, tracking the number of concurrent lookups.
+type slowHandler struct {
+	mu       sync.Mutex
+	inflight int
+	max      int
+}
+
+func (h *slowHandler) Get(key string) MemcachedResponse {
+	h.mu.Lock()
+	h.inflight++
+	if h.inflight > h.max {
+		h.max = h.inflight
+	}
+	h.mu.Unlock()
+	delay, _ := strconv.Atoi(key)
+	time.Sleep(time.Duration(delay) * time.Millisecond)
+	h.mu.Lock()
+	h.inflight--
+	h.mu.Unlock()
+	return &ItemResponse{Item: &Item{Key: key, Value: []byte(key)}}
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	h := &slowHandler{}
+	s := NewServer("", h)
+	s.MaxPipelineDepth = 2
+	c := serveConn(t, s)
+
+	c.send("get 60\r\nget 30\r\nget 10\r\nversion\r\nget 20\r\n")
+	c.expect(
+		"VALUE 60 0 2", "60", "END",
+		"VALUE 30 0 2", "30", "END",
+		"VALUE 10 0 2", "10", "END",
+		"VERSION "+VERSION,
+		"VALUE 20 0 2", "20", "END",
+	)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	require.Equal(t, 2, h.max)
+}
+
+func TestServer_PipeliningFlush(t *testing.T) {
+	h := newMapHandler()
+	h.items["a"] = &Item{Key: "a", Value: []byte("1")}
+	s := NewServer("", h)
+	c := serveConn(t, s)
+
+	// The get is followed by a command without a response.
+	c.send("get a\r\nset b 0 0 1 noreply\r\nx\r\n")
+	c.expect("VALUE a 0 1", "1", "END")
+	// Only a part of the next command is buffered.
+	c.send("get a\r\nver")
+	c.expect("VALUE a 0 1", "1", "END")
+	c.send("sion\r\n")
+	c.expect("VERSION " + VERSION)
+	// The data block of the set follows after the response to the get.
+	c.send("get a\r\nset c 0 0 1\r\n")
+	c.expect("VALUE a 0 1", "1", "END")
+	c.send("y\r\n")
+	c.expect("STORED")
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	s := NewServer("", newMapHandler())
+	s.IdleTimeout = 50 * time.Millisecond
+	c := serveConn(t, s)
+
+	c.send("version\r\n")
+	c.expect("VERSION " + VERSION)
+	_, err := c.r.ReadByte()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer_ListenAndServeUnix(t *testing.T) {
+	// Keep the path short, socket paths are limited to ~100 bytes.
+	dir, err := os.MkdirTemp("", "mc")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "mc.sock")
+	// Leave a stale socket file behind.
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := NewServer("", newMapHandler())
+	s.Socket = path
+	s.SocketPerm = 0o600
+	go s.ListenAndServe()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("unix", path)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	defer conn.Close()
+	c := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.send("version\r\n")
+	c.expect("VERSION " + VERSION)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+}
+
+func TestServer_Authentication(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\nservice-a:secret\n"), 0o600))
+	auth, err := NewFileAuthenticator(path)
+	require.NoError(t, err)
+	h := newMapHandler()
+	h.items["foo"] = &Item{Key: "foo", Value: []byte("bar")}
+	s := NewServer("", h)
+	s.Authenticator = auth
+	c := serveConn(t, s)
+
+	c.send("get foo\r\n")
+	c.expect("CLIENT_ERROR unauthenticated")
+	c.send("set auth 0 0 16\r\nservice-a secre7\r\n")
+	c.expect("CLIENT_ERROR authentication failure")
+	c.send("set auth 0 0 16\r\nservice-a secret\r\n")
+	c.expect("STORED")
+	c.send("get foo\r\n")
+	c.expect("VALUE foo 0 3", "bar", "END")
+	require.Eventually(t, func() bool { return s.Stats.AuthErrors.String() == "1" }, time.Second, 10*time.Millisecond)
+	// Without admin users, nobody may issue administrative commands when clients authenticate.
+	c.send("readonly on\r\n")
+	c.expect("CLIENT_ERROR access denied")
+	s.AdminUsers = []string{"service-a"}
+	c.send("readonly on\r\n")
+	c.expect("OK")
+}
+
+func TestServer_ReadOnly(t *testing.T) {
+	h := newMapHandler()
+	s := NewServer("", h)
+	c := serveConn(t, s)
+
+	c.send("readonly on\r\n")
+	c.expect("OK")
+	require.True(t, s.ReadOnly())
+	c.send("set foo 0 0 3\r\nbar\r\n")
+	c.expect("SERVER_ERROR server is in read-only mode")
+	c.send("set foo 0 0 3 noreply\r\nbar\r\n")
+	c.send("get foo\r\n")
+	c.expect("END")
+	require.Eventually(t, func() bool { return s.Stats.ReadOnlyRejected.String() == "2" }, time.Second, 10*time.Millisecond)
+
+	c.send("readonly off\r\n")
+	c.expect("OK")
+	c.send("set foo 0 0 3\r\nbar\r\n")
+	c.expect("STORED")
+}
+
+func TestServer_ReadOnlyAdminUsers(t *testing.T) {
+	s := NewServer("", newMapHandler())
+	s.AdminUsers = []string{"ops"}
+	c := serveConn(t, s)
+
+	c.send("readonly on\r\n")
+	c.expect("CLIENT_ERROR access denied")
+	require.False(t, s.ReadOnly())
+}
+
+func TestServer_Scan(t *testing.T) {
+	h := newMapHandler()
+	for _, key := range []string{"a:1", "a:2", "a:3", "b:1"} {
+		h.items[key] = &Item{Key: key, Value: []byte(key)}
+	}
+	s := NewServer("", h)
+	s.MaxScanLimit = 2
+	c := serveConn(t, s)
+
+	c.send("scan prefix a:\r\n")
+	c.expect("VALUE a:1 0 3", "a:1", "VALUE a:2 0 3", "a:2", "END")
+	c.send("scan range a:3 b:9 10\r\n")
+	c.expect("VALUE a:3 0 3", "a:3", "VALUE b:1 0 3", "b:1", "END")
+	c.send("scan prefix c:\r\n")
+	c.expect("END")
+	c.send("scan prefix a: x\r\n")
+	c.expect("CLIENT_ERROR bad command line format")
+	c.send("scan suffix a:\r\n")
+	c.expect("ERROR")
+	require.Eventually(t, func() bool { return s.Stats.CMDScan.String() == "3" }, time.Second, 10*time.Millisecond)
+}
@@ -86,21 +86,30 @@ const (
 )
 
 type Stats struct {
-	PID              *StaticStat
-	Uptime           *TimerStat
-	Time             *FuncStat
-	Version          *StaticStat
-	Golang           *StaticStat
-	Goroutines       *FuncStat
-	RUsageUser       *FuncStat
-	RUsageSystem     *FuncStat
-	CMDGet           *CounterStat
-	CMDSet           *CounterStat
-	GetHits          *CounterStat
-	GetMisses        *CounterStat
-	CurrConnections  *CounterStat
-	TotalConnections *CounterStat
-	Evictions        *CounterStat
+	PID                 *StaticStat
+	Uptime              *TimerStat
+	Time                *FuncStat
+	Version             *StaticStat
+	Golang              *StaticStat
+	Goroutines          *FuncStat
+	RUsageUser          *FuncStat
+	RUsageSystem        *FuncStat
+	CMDGet              *CounterStat
+	CMDSet              *CounterStat
+	CMDScan             *CounterStat
+	GetHits             *CounterStat
+	GetMisses           *CounterStat
+	CurrConnections     *CounterStat
+	TotalConnections    *CounterStat
+	Evictions           *CounterStat
+	RejectedConnections *CounterStat
+	AuthCmds            *CounterStat
+	AuthErrors          *CounterStat
+	AsyncWriteErrors    *CounterStat
+	ReadOnlyRejected    *CounterStat
+	ReadOnly            *FuncStat
+	// Extra are additional stats of handlers, reported under their names.
+	Extra map[string]fmt.Stringer
 }
 
 func (s Stats) Snapshot() map[string]string {
@@ -115,11 +124,23 @@ func (s Stats) Snapshot() map[string]string {
 	m["rusage_system"] = s.RUsageSystem.String()
 	m["cmd_get"] = s.CMDGet.String()
 	m["cmd_set"] = s.CMDSet.String()
+	m["cmd_scan"] = s.CMDScan.String()
 	m["get_hits"] = s.GetHits.String()
 	m["get_misses"] = s.GetMisses.String()
 	m["curr_connections"] = s.CurrConnections.String()
 	m["total_connections"] = s.TotalConnections.String()
 	m["evictions"] = s.Evictions.String()
+	m["rejected_connections"] = s.RejectedConnections.String()
+	m["auth_cmds"] = s.AuthCmds.String()
+	m["auth_errors"] = s.AuthErrors.String()
+	m["async_write_errors"] = s.AsyncWriteErrors.String()
+	m["read_only_rejected"] = s.ReadOnlyRejected.String()
+	if s.ReadOnly != nil {
+		m["read_only"] = s.ReadOnly.String()
+	}
+	for name, stat := range s.Extra {
+		m[name] = stat.String()
+	}
 	return m
 }
 
@@ -135,10 +156,17 @@ func NewStats() Stats {
 	s.RUsageSystem = &FuncStat{func() string { return fmt.Sprintf("%f", getRusage(SystemTime)) }}
 	s.CMDGet = NewCounterStat()
 	s.CMDSet = NewCounterStat()
+	s.CMDScan = NewCounterStat()
 	s.GetHits = NewCounterStat()
 	s.GetMisses = NewCounterStat()
 	s.CurrConnections = NewCounterStat()
 	s.TotalConnections = NewCounterStat()
 	s.Evictions = NewCounterStat()
+	s.RejectedConnections = NewCounterStat()
+	s.AuthCmds = NewCounterStat()
+	s.AuthErrors = NewCounterStat()
+	s.AsyncWriteErrors = NewCounterStat()
+	s.ReadOnlyRejected = NewCounterStat()
+	s.Extra = make(map[string]fmt.Stringer)
 	return s
 }
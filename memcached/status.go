@@ -1,22 +1,26 @@
 package memcached
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 const (
-	StatusEnd         = "END\r\n"
-	StatusError       = "ERROR\r\n"
-	StatusServerError = "SERVER_ERROR\r\n"
-	StatusClientError = "CLIENT_ERROR %s\r\n"
-	StatusStored      = "STORED\r\n"
-	StatusNotStored   = "NOT_STORED\r\n"
-	StatusExists      = "EXISTS\r\n"
-	StatusNotFound    = "NOT_FOUND\r\n"
-	StatusDeleted     = "DELETED\r\n"
-	StatusTouched     = "TOUCHED\r\n"
-	StatusOK          = "OK\r\n"
-	StatusVersion     = "VERSION %s\r\n"
-	StatusValue       = "VALUE %s %d %d\r\n"
-	StatusStat        = "STAT %s %s\r\n"
+	StatusEnd                = "END\r\n"
+	StatusError              = "ERROR\r\n"
+	StatusServerError        = "SERVER_ERROR\r\n"
+	StatusServerErrorMessage = "SERVER_ERROR %s\r\n"
+	StatusClientError        = "CLIENT_ERROR %s\r\n"
+	StatusStored             = "STORED\r\n"
+	StatusNotStored          = "NOT_STORED\r\n"
+	StatusExists             = "EXISTS\r\n"
+	StatusNotFound           = "NOT_FOUND\r\n"
+	StatusDeleted            = "DELETED\r\n"
+	StatusTouched            = "TOUCHED\r\n"
+	StatusOK                 = "OK\r\n"
+	StatusVersion            = "VERSION %s\r\n"
+	StatusValue              = "VALUE %s %d %d\r\n"
+	StatusStat               = "STAT %s %s\r\n"
 )
 
 var (
@@ -29,3 +33,43 @@ var (
 	// Error is a generic error.
 	Error = errors.New(StatusError)
 )
+
+// ClientErrorReason is an error caused by an invalid command from the client
+// which is reported back as CLIENT_ERROR with the reason attached.
+type ClientErrorReason string
+
+func (r ClientErrorReason) Error() string {
+	return fmt.Sprintf(StatusClientError, string(r))
+}
+
+const (
+	// BadCommandLineFormat is returned when the command line could not be parsed.
+	BadCommandLineFormat ClientErrorReason = "bad command line format"
+	// BadDataChunk is returned when the data block does not match the announced length.
+	BadDataChunk ClientErrorReason = "bad data chunk"
+	// LineTooLong is returned when the command line does not fit into the read buffer.
+	LineTooLong ClientErrorReason = "line too long"
+	// Unauthenticated is returned for commands of clients which did not authenticate yet.
+	Unauthenticated ClientErrorReason = "unauthenticated"
+	// AuthenticationFailure is returned when the client credentials were refused.
+	AuthenticationFailure ClientErrorReason = "authentication failure"
+	// AccessDenied is returned when the client is not allowed to issue the command.
+	AccessDenied ClientErrorReason = "access denied"
+)
+
+// ServerErrorReason is an error occurred servicing the request
+// which is reported back as SERVER_ERROR with the reason attached.
+type ServerErrorReason string
+
+func (r ServerErrorReason) Error() string {
+	return fmt.Sprintf(StatusServerErrorMessage, string(r))
+}
+
+const (
+	// ObjectTooLarge is returned when the data block exceeds the maximum item size.
+	ObjectTooLarge ServerErrorReason = "object too large for cache"
+	// TooManyConnections is sent to connections rejected over the connection limit.
+	TooManyConnections ServerErrorReason = "too many open connections"
+	// ReadOnlyMode is returned for storage and delete commands while the server is in read-only mode.
+	ReadOnlyMode ServerErrorReason = "server is in read-only mode"
+)
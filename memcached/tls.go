@@ -0,0 +1,140 @@
+package memcached
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultHandshakeTimeout is the maximum time of a TLS handshake when neither ReadTimeout nor IdleTimeout is set.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// handshakeTimeout is the maximum time of a TLS handshake, so that clients which never complete
+// it do not hold a connection slot forever.
+func (s *Server) handshakeTimeout() time.Duration {
+	switch {
+	case s.ReadTimeout > 0:
+		return s.ReadTimeout
+	case s.IdleTimeout > 0:
+		return s.IdleTimeout
+	}
+	return DefaultHandshakeTimeout
+}
+
+// TLSOptions configures TLS of the memcached listener.
+type TLSOptions struct {
+	// CertFile and KeyFile are paths to the PEM encoded server certificate and its private key.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a path to PEM encoded certificate authorities used to verify
+	// client certificates. Setting it requires clients to authenticate with mutual TLS.
+	ClientCAFile string
+	// MinVersion is the minimum accepted TLS version, one of "1.0", "1.1", "1.2" or "1.3". Defaults to "1.2".
+	MinVersion string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig creates a server TLS configuration from the options. Certificate, key and client CA files
+// are watched for changes and re-read on the next handshake, so rotated certificates are used without a restart.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if opts.MinVersion == "" {
+		opts.MinVersion = "1.2"
+	}
+	minVersion, ok := tlsVersions[opts.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version %q", opts.MinVersion)
+	}
+	r := &tlsReloader{opts: opts, minVersion: minVersion}
+	if _, err := r.config(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion: minVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config()
+		},
+	}, nil
+}
+
+// tlsReloader keeps a TLS configuration loaded from files up to date with the files on disk.
+type tlsReloader struct {
+	opts       TLSOptions
+	minVersion uint16
+
+	mu      sync.Mutex
+	modTime time.Time
+	current *tls.Config
+}
+
+// config returns the current configuration, reloading it first if any of the files changed.
+// A configuration which fails to load, e.g. because the files are being rotated,
+// is ignored and the previous one is used instead.
+func (r *tlsReloader) config() (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	modTime, err := r.latestModTime()
+	if err == nil && r.current != nil && !modTime.After(r.modTime) {
+		return r.current, nil
+	}
+	if err == nil {
+		var cfg *tls.Config
+		if cfg, err = r.load(); err == nil {
+			r.current, r.modTime = cfg, modTime
+		}
+	}
+	if r.current == nil {
+		return nil, err
+	}
+	return r.current, nil
+}
+
+func (r *tlsReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *tlsReloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   r.minVersion,
+	}
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in the client CA file")
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
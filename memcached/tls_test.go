@@ -0,0 +1,176 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func (c *testCert) writeFiles(t *testing.T, certFile, keyFile string) {
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	if keyFile == "" {
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+}
+
+// newTestCert issues a certificate for the common name signed by the parent, self-signed if parent is nil.
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+type clientNameHandler struct{}
+
+func (h *clientNameHandler) Get(key string) MemcachedResponse {
+	return h.GetContext(context.Background(), key)
+}
+
+// GetContext responds with the common name of the client certificate.
+func (h *clientNameHandler) GetContext(ctx context.Context, key string) MemcachedResponse {
+	client, ok := ClientFromContext(ctx)
+	if !ok || client.Certificate() == nil {
+		return nil
+	}
+	return &ItemResponse{Item: &Item{Key: key, Value: []byte(client.Certificate().Subject.CommonName)}}
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "localhost", ca)
+	client := newTestCert(t, "service-a", ca)
+	opts := TLSOptions{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	server.writeFiles(t, opts.CertFile, opts.KeyFile)
+	ca.writeFiles(t, opts.ClientCAFile, "")
+
+	tlsConfig, err := NewTLSConfig(opts)
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewServer("", &clientNameHandler{})
+	s.TLSConfig = tlsConfig
+	go s.Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	dial := func(certs ...tls.Certificate) (*tls.Conn, error) {
+		return tls.Dial("tcp", l.Addr().String(), &tls.Config{
+			ServerName:   "localhost",
+			RootCAs:      roots,
+			Certificates: certs,
+			MinVersion:   tls.VersionTLS12,
+		})
+	}
+
+	conn, err := dial(client.tlsCertificate())
+	require.NoError(t, err)
+	defer conn.Close()
+	c := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.send("get foo\r\n")
+	c.expect("VALUE foo 0 9", "service-a", "END")
+
+	// The server refuses clients without a certificate.
+	anonymous, err := dial()
+	if err == nil {
+		defer anonymous.Close()
+		_, err = anonymous.Write([]byte("get foo\r\n"))
+		if err == nil {
+			_, err = bufio.NewReader(anonymous).ReadString('\n')
+		}
+	}
+	require.Error(t, err)
+
+	// Rotated server certificate is picked up by new connections.
+	rotated := newTestCert(t, "localhost", ca)
+	rotated.writeFiles(t, opts.CertFile, opts.KeyFile)
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(opts.CertFile, later, later))
+	conn2, err := dial(client.tlsCertificate())
+	require.NoError(t, err)
+	defer conn2.Close()
+	require.Equal(t, rotated.cert.Raw, conn2.ConnectionState().PeerCertificates[0].Raw)
+}
+
+func TestServer_TLSHandshakeTimeout(t *testing.T) {
+	dir := t.TempDir()
+	server := newTestCert(t, "localhost", nil)
+	opts := TLSOptions{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")}
+	server.writeFiles(t, opts.CertFile, opts.KeyFile)
+	tlsConfig, err := NewTLSConfig(opts)
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := NewServer("", newMapHandler())
+	s.TLSConfig = tlsConfig
+	s.IdleTimeout = 50 * time.Millisecond
+	go s.Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	// Without ReadTimeout, a client which never starts the handshake is dropped after IdleTimeout.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestNewTLSConfig_InvalidVersion(t *testing.T) {
+	_, err := NewTLSConfig(TLSOptions{MinVersion: "2.0"})
+	require.Error(t, err)
+}
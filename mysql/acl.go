@@ -0,0 +1,157 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/coufalja/memcached-mysql/memcached"
+	"go.uber.org/zap"
+)
+
+type permission uint8
+
+const (
+	permRead permission = 1 << iota
+	permWrite
+	permDelete
+)
+
+var (
+	errAccessDenied    = errors.New(accessDenied)
+	errReadOnlyMapping = errors.New("mapping is read-only")
+)
+
+var permissionNames = map[string]permission{
+	config.PermissionRead:   permRead,
+	config.PermissionWrite:  permWrite,
+	config.PermissionDelete: permDelete,
+}
+
+func (p permission) String() string {
+	for name, perm := range permissionNames {
+		if p == perm {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// accessRule grants permissions to clients matched by a principal.
+type accessRule struct {
+	match       func(*memcached.Client) bool
+	permissions permission
+}
+
+// accessList is a list of rules of a mapping. An empty list grants every permission to everybody.
+type accessList []accessRule
+
+func newAccessList(acl []config.ACL) (accessList, error) {
+	list := make(accessList, 0, len(acl))
+	for _, entry := range acl {
+		match, err := principalMatcher(entry.Principal)
+		if err != nil {
+			return nil, err
+		}
+		rule := accessRule{match: match}
+		for _, name := range entry.Permissions {
+			perm, ok := permissionNames[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown permission %q", name)
+			}
+			rule.permissions |= perm
+		}
+		list = append(list, rule)
+	}
+	return list, nil
+}
+
+// allows checks whether the client was granted the permission.
+func (l accessList) allows(client *memcached.Client, perm permission) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, rule := range l {
+		if rule.permissions&perm != 0 && rule.match(client) {
+			return true
+		}
+	}
+	return false
+}
+
+// principalMatcher parses the principal in the form user:<name>, cn:<name>, ip:<address or CIDR> or *.
+func principalMatcher(principal string) (func(*memcached.Client) bool, error) {
+	if principal == "*" {
+		return func(*memcached.Client) bool { return true }, nil
+	}
+	kind, value, ok := strings.Cut(principal, ":")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("invalid principal %q", principal)
+	}
+	switch kind {
+	case "user":
+		return func(c *memcached.Client) bool { return c.User == value }, nil
+	case "cn":
+		return func(c *memcached.Client) bool {
+			cert := c.Certificate()
+			return cert != nil && cert.Subject.CommonName == value
+		}, nil
+	case "ip":
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(value)
+			if aerr != nil {
+				return nil, fmt.Errorf("invalid principal %q: %w", principal, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		return func(c *memcached.Client) bool {
+			addr, ok := clientAddr(c)
+			return ok && prefix.Contains(addr)
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid principal %q", principal)
+	}
+}
+
+func clientAddr(c *memcached.Client) (netip.Addr, bool) {
+	tcp, ok := c.RemoteAddr.(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	addr, ok := netip.AddrFromSlice(tcp.IP)
+	return addr.Unmap(), ok
+}
+
+// authorize checks the client the request originates from was granted the permission on the mapping
+// and that the mapping is not read-only for write and delete permissions. Denied requests are logged for auditing.
+func (c *Proxy) authorize(ctx context.Context, mapping string, table *tableProxy, perm permission, key string) error {
+	if perm != permRead && table.readOnly {
+		return errReadOnlyMapping
+	}
+	client, ok := memcached.ClientFromContext(ctx)
+	if !ok {
+		client = &memcached.Client{}
+	}
+	if table.acl.allows(client, perm) {
+		return nil
+	}
+	fields := []zap.Field{
+		zap.String("mapping", mapping),
+		zap.String("key", key),
+		zap.Stringer("permission", perm),
+		zap.String("user", client.User),
+	}
+	if client.RemoteAddr != nil {
+		fields = append(fields, zap.Stringer("remoteAddr", client.RemoteAddr))
+	}
+	if cert := client.Certificate(); cert != nil {
+		fields = append(fields, zap.String("cn", cert.Subject.CommonName))
+	}
+	c.Logger.Warn("access denied", fields...)
+	return errAccessDenied
+}
@@ -0,0 +1,97 @@
+package mysql
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/coufalja/memcached-mysql/memcached"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func certClient(cn string) *memcached.Client {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+	return &memcached.Client{TLS: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+}
+
+func Test_accessList_allows(t *testing.T) {
+	acl := []config.ACL{
+		{Principal: "user:service-a", Permissions: []string{config.PermissionRead}},
+		{Principal: "cn:service-b", Permissions: []string{config.PermissionRead, config.PermissionWrite}},
+		{Principal: "ip:10.0.0.0/8", Permissions: []string{config.PermissionDelete}},
+	}
+	tests := []struct {
+		name   string
+		acl    []config.ACL
+		client *memcached.Client
+		perm   permission
+		want   bool
+	}{
+		{name: "empty list allows everything", client: &memcached.Client{}, perm: permWrite, want: true},
+		{name: "user granted", acl: acl, client: &memcached.Client{User: "service-a"}, perm: permRead, want: true},
+		{name: "user not granted", acl: acl, client: &memcached.Client{User: "service-a"}, perm: permWrite, want: false},
+		{name: "unknown user", acl: acl, client: &memcached.Client{User: "service-c"}, perm: permRead, want: false},
+		{name: "certificate granted", acl: acl, client: certClient("service-b"), perm: permWrite, want: true},
+		{name: "ip granted", acl: acl, client: &memcached.Client{RemoteAddr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3")}}, perm: permDelete, want: true},
+		{name: "ip outside of range", acl: acl, client: &memcached.Client{RemoteAddr: &net.TCPAddr{IP: net.ParseIP("192.168.1.1")}}, perm: permDelete, want: false},
+		{
+			name:   "everybody",
+			acl:    []config.ACL{{Principal: "*", Permissions: []string{config.PermissionRead}}},
+			client: &memcached.Client{},
+			perm:   permRead,
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newAccessList(tt.acl)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, l.allows(tt.client, tt.perm))
+		})
+	}
+}
+
+func Test_newAccessList_invalid(t *testing.T) {
+	for _, acl := range []config.ACL{
+		{Principal: "group:foo", Permissions: []string{config.PermissionRead}},
+		{Principal: "ip:not-an-ip", Permissions: []string{config.PermissionRead}},
+		{Principal: "user:foo", Permissions: []string{"admin"}},
+	} {
+		_, err := newAccessList([]config.ACL{acl})
+		require.Error(t, err, acl.Principal)
+	}
+}
+
+func TestProxy_GetContext_accessDenied(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectPrepare("SELECT `value` FROM `sessions` WHERE `key`=?")
+	c, err := New(db, []config.Mapping{{
+		Name:        "sessions",
+		KeyColumn:   "key",
+		ValueColumn: "value",
+		Table:       "sessions",
+		ACL:         []config.ACL{{Principal: "user:service-a", Permissions: []string{config.PermissionRead}}},
+	}})
+	require.NoError(t, err)
+
+	ctx := memcached.NewClientContext(context.Background(), &memcached.Client{User: "service-b"})
+	got := c.GetContext(ctx, "@@sessions.foo")
+	require.Equal(t, &memcached.ClientErrorResponse{Reason: accessDenied}, got)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProxy_authorize_readOnly(t *testing.T) {
+	c := &Proxy{Logger: zap.NewNop()}
+	table := &tableProxy{readOnly: true}
+	ctx := context.Background()
+	require.NoError(t, c.authorize(ctx, "sessions", table, permRead, "foo"))
+	require.ErrorIs(t, c.authorize(ctx, "sessions", table, permWrite, "foo"), errReadOnlyMapping)
+	require.ErrorIs(t, c.authorize(ctx, "sessions", table, permDelete, "foo"), errReadOnlyMapping)
+}
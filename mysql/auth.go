@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coufalja/memcached-mysql/config"
+)
+
+// Authenticator authenticates memcached clients against credentials stored in a MySQL table.
+// Passwords are stored either in plain text or hashed, see config.Auth.PasswordHash.
+// The hash is an unsalted SHA-256 digest which is cheap to brute force, so the table must hold
+// generated service credentials rather than passwords people reuse elsewhere.
+type Authenticator struct {
+	query  *sql.Stmt
+	hashed bool
+}
+
+// NewAuthenticator creates an Authenticator looking up passwords of users in the table.
+func NewAuthenticator(db *sql.DB, table, userColumn, passwordColumn, passwordHash string) (*Authenticator, error) {
+	a := &Authenticator{}
+	switch passwordHash {
+	case "", config.PasswordHashPlain:
+	case config.PasswordHashSHA256:
+		a.hashed = true
+	default:
+		return nil, fmt.Errorf("unknown password hash %q", passwordHash)
+	}
+	stmt, err := db.Prepare(formatSelectQuery([]string{passwordColumn}, table, []string{userColumn}))
+	if err != nil {
+		return nil, err
+	}
+	a.query = stmt
+	return a, nil
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, username, password string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var expected sql.NullString
+	if err := a.query.QueryRowContext(ctx, username).Scan(&expected); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !expected.Valid {
+		return false, nil
+	}
+	if a.hashed {
+		// Compare digests, the stored one is hex encoded in either case.
+		sum := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(strings.ToLower(expected.String)), []byte(hex.EncodeToString(sum[:]))) == 1, nil
+	}
+	return subtle.ConstantTimeCompare([]byte(expected.String), []byte(password)) == 1, nil
+}
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+		mock     func(sqlmock.Sqlmock)
+		want     bool
+	}{
+		{
+			name:     "valid password",
+			password: "secret",
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `password` FROM `users` WHERE `user`=.+").WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow("secret"))
+			},
+			want: true,
+		},
+		{
+			name:     "invalid password",
+			password: "guess",
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `password` FROM `users` WHERE `user`=.+").WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow("secret"))
+			},
+			want: false,
+		},
+		{
+			name:     "valid hashed password",
+			password: "secret",
+			hash:     config.PasswordHashSHA256,
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `password` FROM `users` WHERE `user`=.+").
+					WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow("2BB80D537B1DA3E38BD30361AA855686BDE0EACD7162FEF6A25FE97BF527A25B"))
+			},
+			want: true,
+		},
+		{
+			name:     "hashed password compared in plain text",
+			password: "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+			hash:     config.PasswordHashSHA256,
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `password` FROM `users` WHERE `user`=.+").
+					WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow("2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"))
+			},
+			want: false,
+		},
+		{
+			name:     "unknown user",
+			password: "secret",
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `password` FROM `users` WHERE `user`=.+").WillReturnRows(sqlmock.NewRows([]string{"password"}))
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			mock.ExpectPrepare("SELECT `password` FROM `users` WHERE `user`=?")
+			tt.mock(mock)
+			a, err := NewAuthenticator(db, "users", "user", "password", tt.hash)
+			require.NoError(t, err)
+			got, err := a.Authenticate(context.Background(), "service-a", tt.password)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
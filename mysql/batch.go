@@ -0,0 +1,237 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/coufalja/memcached-mysql/memcached"
+)
+
+var errQueueFull = errors.New("write queue full")
+
+// writeBehind buffers writes of a table, coalescing them by key, and flushes them in batches.
+type writeBehind struct {
+	db        *sql.DB
+	query     func(rows int) string
+	batchSize int
+	interval  time.Duration
+	queueSize int
+	block     bool
+	// onError receives errors of failed flushes and the number of rows dropped by them.
+	// The rows of a failed batch are retried one by one, only the failing rows are dropped.
+	onError func(err error, rows int)
+
+	mu sync.Mutex
+	// closed is set by Close, later writes are executed synchronously.
+	closed bool
+	// pending are arguments of buffered writes by key, order is the order of first writes of the keys.
+	pending map[string][]interface{}
+	order   []string
+	// freed is closed when a flush takes the pending writes, unblocking writers waiting for space.
+	freed chan struct{}
+
+	flush    chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	flushes       *memcached.CounterStat
+	flushErrors   *memcached.CounterStat
+	dropped       *memcached.CounterStat
+	rejected      *memcached.CounterStat
+	flushDuration time.Duration
+}
+
+func newWriteBehind(db *sql.DB, conf config.WriteBehind, query func(rows int) string) *writeBehind {
+	w := &writeBehind{
+		db:          db,
+		query:       query,
+		batchSize:   conf.BatchSize,
+		interval:    conf.FlushInterval,
+		queueSize:   conf.QueueSize,
+		block:       conf.Backpressure != config.BackpressureReject,
+		onError:     func(error, int) {},
+		pending:     make(map[string][]interface{}),
+		freed:       make(chan struct{}),
+		flush:       make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		flushes:     memcached.NewCounterStat(),
+		flushErrors: memcached.NewCounterStat(),
+		dropped:     memcached.NewCounterStat(),
+		rejected:    memcached.NewCounterStat(),
+	}
+	go w.run()
+	return w
+}
+
+// enqueue buffers the write arguments of the key, replacing a buffered write of the same key.
+// When the queue is full, it waits for a flush or fails with errQueueFull depending on the backpressure policy.
+// Once closed, the write is executed right away as there is no flush to pick it up.
+func (w *writeBehind) enqueue(ctx context.Context, key string, args []interface{}) error {
+	w.mu.Lock()
+	for {
+		if w.closed {
+			w.mu.Unlock()
+			// Wait for the final flush, so that the write is not overtaken by a buffered write of the key.
+			<-w.stopped
+			_, err := w.db.ExecContext(ctx, w.query(1), args...)
+			return err
+		}
+		if _, ok := w.pending[key]; ok || len(w.pending) < w.queueSize {
+			break
+		}
+		if !w.block {
+			w.mu.Unlock()
+			w.rejected.Increment(1)
+			return errQueueFull
+		}
+		freed := w.freed
+		w.mu.Unlock()
+		w.requestFlush()
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			w.rejected.Increment(1)
+			return ctx.Err()
+		}
+		w.mu.Lock()
+	}
+	if _, ok := w.pending[key]; !ok {
+		w.order = append(w.order, key)
+	}
+	w.pending[key] = args
+	full := len(w.pending) >= w.batchSize
+	w.mu.Unlock()
+	if full {
+		w.requestFlush()
+	}
+	return nil
+}
+
+func (w *writeBehind) requestFlush() {
+	select {
+	case w.flush <- struct{}{}:
+	default:
+	}
+}
+
+func (w *writeBehind) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.flush:
+		case <-w.done:
+			w.flushPending()
+			return
+		}
+		w.flushPending()
+	}
+}
+
+// flushPending writes all buffered writes in batches of at most batchSize rows.
+func (w *writeBehind) flushPending() {
+	w.mu.Lock()
+	pending, order := w.pending, w.order
+	w.pending, w.order = make(map[string][]interface{}), nil
+	close(w.freed)
+	w.freed = make(chan struct{})
+	w.mu.Unlock()
+
+	for len(order) > 0 {
+		n := len(order)
+		if n > w.batchSize {
+			n = w.batchSize
+		}
+		var args []interface{}
+		for _, key := range order[:n] {
+			args = append(args, pending[key]...)
+		}
+
+		batch := order[:n]
+		order = order[n:]
+
+		start := time.Now()
+		err := w.exec(n, args)
+		if err != nil && n > 1 {
+			// A single bad row fails the whole batch, retry the rows one by one to drop only the bad ones.
+			dropped := 0
+			for _, key := range batch {
+				if rowErr := w.exec(1, pending[key]); rowErr != nil {
+					err = rowErr
+					dropped++
+				}
+			}
+			w.flushErrors.Increment(1)
+			if dropped > 0 {
+				w.dropped.Increment(dropped)
+				w.onError(err, dropped)
+			}
+		} else if err != nil {
+			w.flushErrors.Increment(1)
+			w.dropped.Increment(n)
+			w.onError(err, n)
+		}
+		w.mu.Lock()
+		w.flushDuration = time.Since(start)
+		w.mu.Unlock()
+		w.flushes.Increment(1)
+	}
+}
+
+// exec writes the rows of the arguments.
+func (w *writeBehind) exec(rows int, args []interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := w.db.ExecContext(ctx, w.query(rows), args...)
+	return err
+}
+
+// Close flushes the buffered writes and stops flushing, later writes are executed synchronously.
+func (w *writeBehind) Close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.stopOnce.Do(func() { close(w.done) })
+	<-w.stopped
+}
+
+// stats reports the queue depth, the duration of the last flush and counts of flushes, failed flushes,
+// dropped rows and rejected writes.
+func (w *writeBehind) stats(prefix string) map[string]fmt.Stringer {
+	return map[string]fmt.Stringer{
+		prefix + "queue_depth": &memcached.FuncStat{Callable: func() string {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			return strconv.Itoa(len(w.pending))
+		}},
+		prefix + "flush_duration_us": &memcached.FuncStat{Callable: func() string {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			return strconv.FormatInt(w.flushDuration.Microseconds(), 10)
+		}},
+		prefix + "flushes":      w.flushes,
+		prefix + "flush_errors": w.flushErrors,
+		prefix + "dropped":      w.dropped,
+		prefix + "rejected":     w.rejected,
+	}
+}
+
+// batchKey identifies the row of the key arguments within a batch.
+func batchKey(args []interface{}) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = fmt.Sprint(a)
+	}
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,134 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/coufalja/memcached-mysql/memcached"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy_Set_writeBehind(t *testing.T) {
+	tests := []struct {
+		name         string
+		backpressure string
+		items        []*memcached.Item
+		want         []memcached.MemcachedResponse
+		mock         func(sqlmock.Sqlmock)
+	}{
+		{
+			name:         "coalesce writes of the same key",
+			backpressure: config.BackpressureReject,
+			items: []*memcached.Item{
+				{Key: "a", Value: []byte("1")},
+				{Key: "b", Value: []byte("2")},
+				{Key: "a", Value: []byte("3")},
+			},
+			want: []memcached.MemcachedResponse{nil, nil, nil},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectExec("INSERT INTO `test` \\(`key`,`value`\\) VALUES \\(\\?,\\?\\),\\(\\?,\\?\\) ON DUPLICATE KEY UPDATE `value`=VALUES\\(`value`\\)").
+					WithArgs("a", []byte("3"), "b", []byte("2")).WillReturnResult(sqlmock.NewResult(2, 2))
+			},
+		},
+		{
+			name:         "reject writes to a full queue",
+			backpressure: config.BackpressureReject,
+			items: []*memcached.Item{
+				{Key: "a", Value: []byte("1")},
+				{Key: "b", Value: []byte("2")},
+				{Key: "c", Value: []byte("3")},
+				{Key: "a", Value: []byte("4")},
+			},
+			want: []memcached.MemcachedResponse{nil, nil, &memcached.StatusResponse{Status: "SERVER_ERROR write queue full\r\n"}, nil},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectExec("INSERT INTO `test`").WithArgs("a", []byte("4"), "b", []byte("2")).WillReturnResult(sqlmock.NewResult(2, 2))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, s, err := sqlmock.New()
+			require.NoError(t, err)
+			s.ExpectPrepare("SELECT `value` FROM `test` WHERE `key`=?")
+			s.ExpectQuery("SELECT `value` FROM `test` WHERE `key`=.*").WillReturnRows(sqlmock.NewRows([]string{"value"}))
+			tt.mock(s)
+			c, err := New(db, []config.Mapping{{
+				Name:        "default",
+				KeyColumn:   "key",
+				ValueColumn: "value",
+				Table:       "test",
+				WriteBehind: config.WriteBehind{
+					Enabled:       true,
+					BatchSize:     3,
+					QueueSize:     2,
+					FlushInterval: time.Hour,
+					Backpressure:  tt.backpressure,
+				},
+			}})
+			require.NoError(t, err)
+			for i, item := range tt.items {
+				require.Equal(t, tt.want[i], c.Set(item))
+			}
+			c.Close()
+			require.NoError(t, s.ExpectationsWereMet())
+		})
+	}
+}
+
+func Test_writeBehind_flushBatches(t *testing.T) {
+	db, s, err := sqlmock.New()
+	require.NoError(t, err)
+	s.ExpectExec("INSERT INTO `test` .+ VALUES \\(\\?,\\?\\),\\(\\?,\\?\\) ON").WithArgs("a", "1", "b", "2").WillReturnResult(sqlmock.NewResult(2, 2))
+	s.ExpectExec("INSERT INTO `test` .+ VALUES \\(\\?,\\?\\) ON").WithArgs("c", "3").WillReturnResult(sqlmock.NewResult(1, 1))
+	w := newWriteBehind(db, config.WriteBehind{BatchSize: 2, QueueSize: 10, FlushInterval: time.Hour}, func(rows int) string {
+		return formatUpsertQuery([]string{"value"}, "test", []string{"key"}, rows)
+	})
+	// Hold off size triggered flushes, so that the queue is flushed on Close only.
+	w.batchSize = 10
+	for _, kv := range [][2]string{{"a", "1"}, {"b", "2"}, {"c", "3"}} {
+		require.NoError(t, w.enqueue(context.Background(), kv[0], []interface{}{kv[0], kv[1]}))
+	}
+	w.batchSize = 2
+	w.Close()
+	require.NoError(t, s.ExpectationsWereMet())
+	require.Eventually(t, func() bool { return w.flushes.String() == "2" }, time.Second, 10*time.Millisecond)
+	require.Equal(t, "0", w.stats("")["queue_depth"].String())
+}
+
+func Test_writeBehind_retryFailedBatch(t *testing.T) {
+	db, s, err := sqlmock.New()
+	require.NoError(t, err)
+	s.ExpectExec("INSERT INTO `test` .+ VALUES \\(\\?,\\?\\),\\(\\?,\\?\\),\\(\\?,\\?\\) ON").WithArgs("a", "1", "b", "2", "c", "3").WillReturnError(errors.New("data too long"))
+	s.ExpectExec("INSERT INTO `test` .+ VALUES \\(\\?,\\?\\) ON").WithArgs("a", "1").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.ExpectExec("INSERT INTO `test` .+ VALUES \\(\\?,\\?\\) ON").WithArgs("b", "2").WillReturnError(errors.New("data too long"))
+	s.ExpectExec("INSERT INTO `test` .+ VALUES \\(\\?,\\?\\) ON").WithArgs("c", "3").WillReturnResult(sqlmock.NewResult(1, 1))
+	w := newWriteBehind(db, config.WriteBehind{BatchSize: 10, QueueSize: 10, FlushInterval: time.Hour}, func(rows int) string {
+		return formatUpsertQuery([]string{"value"}, "test", []string{"key"}, rows)
+	})
+	var dropped int
+	w.onError = func(_ error, rows int) { dropped += rows }
+	for _, kv := range [][2]string{{"a", "1"}, {"b", "2"}, {"c", "3"}} {
+		require.NoError(t, w.enqueue(context.Background(), kv[0], []interface{}{kv[0], kv[1]}))
+	}
+	w.Close()
+	require.NoError(t, s.ExpectationsWereMet())
+	require.Equal(t, 1, dropped)
+	require.Eventually(t, func() bool { return w.stats("")["dropped"].String() == "1" }, time.Second, 10*time.Millisecond)
+}
+
+func Test_writeBehind_enqueueAfterClose(t *testing.T) {
+	db, s, err := sqlmock.New()
+	require.NoError(t, err)
+	s.ExpectExec("INSERT INTO `test` .+ VALUES \\(\\?,\\?\\) ON").WithArgs("a", "1").WillReturnResult(sqlmock.NewResult(1, 1))
+	w := newWriteBehind(db, config.WriteBehind{BatchSize: 10, QueueSize: 10, FlushInterval: time.Hour}, func(rows int) string {
+		return formatUpsertQuery([]string{"value"}, "test", []string{"key"}, rows)
+	})
+	w.Close()
+	require.NoError(t, w.enqueue(context.Background(), "a", []interface{}{"a", "1"}))
+	require.NoError(t, s.ExpectationsWereMet())
+	require.Equal(t, "0", w.stats("")["queue_depth"].String())
+}
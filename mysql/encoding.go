@@ -0,0 +1,426 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const escapeChar = '\\'
+
+// Item flags marking the encoding of a value, the delimited encoding has no flag set.
+const (
+	FlagLengthPrefixed = 1 << 8
+	FlagJSON           = 1 << 9
+	FlagMsgpack        = 1 << 10
+	// FlagNull marks an empty value standing for a row whose value columns are all NULL.
+	FlagNull = 1 << 11
+)
+
+var errMalformedValue = errors.New("malformed value")
+
+type columnKind uint8
+
+const (
+	kindText columnKind = iota
+	kindNumber
+	kindBinary
+)
+
+// column is a mapped value column.
+type column struct {
+	name string
+	kind columnKind
+}
+
+// kindOf classifies a MySQL type name as reported by the driver or information_schema.
+func kindOf(typeName string) columnKind {
+	switch strings.ToUpper(typeName) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "DECIMAL", "NUMERIC",
+		"FLOAT", "DOUBLE", "REAL", "YEAR",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		return kindNumber
+	case "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BIT", "GEOMETRY":
+		return kindBinary
+	}
+	return kindText
+}
+
+// valueEncoding converts values of the mapped columns to a memcached value and back.
+// A nil value stands for SQL NULL.
+type valueEncoding interface {
+	encode(columns []column, values [][]byte) ([]byte, error)
+	decode(value []byte, columns []column) ([][]byte, error)
+	// flags are item flags marking the encoding.
+	flags() int
+}
+
+func newValueEncoding(m config.Mapping) (valueEncoding, error) {
+	switch m.Encoding {
+	case "", config.EncodingDelimited:
+		separator := m.Separator
+		if separator == "" {
+			separator = valueSeparator
+		}
+		e := &delimitedEncoding{separator: []byte(separator), escape: m.Escape}
+		if m.NullToken != "" {
+			e.null = []byte(m.NullToken)
+		}
+		return e, nil
+	case config.EncodingLengthPrefixed:
+		return lengthPrefixedEncoding{}, nil
+	case config.EncodingJSON:
+		return jsonEncoding{}, nil
+	case config.EncodingMsgpack:
+		return msgpackEncoding{}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", m.Encoding)
+	}
+}
+
+// delimitedEncoding joins values with a separator. With escaping enabled, the first character of the
+// separator and the escape character are prefixed with a backslash within values, so the values can be split unambiguously.
+// NULL is written as the null token if set, as an empty value otherwise.
+// A single value is passed through as is.
+type delimitedEncoding struct {
+	separator []byte
+	escape    bool
+	null      []byte
+}
+
+// encode joins the values by the separator. A single value is returned as is, unless
+// both escaping and the null token are enabled, then it is escaped to stay distinguishable from the token.
+func (e *delimitedEncoding) encode(_ []column, values [][]byte) ([]byte, error) {
+	if len(values) == 1 && (values[0] == nil || !e.escapeSingle()) {
+		if values[0] == nil && e.null != nil {
+			return e.null, nil
+		}
+		return values[0], nil
+	}
+	var buf bytes.Buffer
+	for i, v := range values {
+		if i > 0 {
+			buf.Write(e.separator)
+		}
+		if v == nil && e.null != nil {
+			buf.Write(e.null)
+			continue
+		}
+		if !e.escape {
+			buf.Write(v)
+			continue
+		}
+		e.writeEscaped(&buf, v)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeEscaped writes the value with separators and backslashes escaped. A value which
+// escapes to the null token is prefixed by a backslash, e.g. NULL is written as \NULL.
+func (e *delimitedEncoding) writeEscaped(buf *bytes.Buffer, v []byte) {
+	start := buf.Len()
+	for len(v) > 0 {
+		if v[0] == escapeChar || v[0] == e.separator[0] {
+			buf.WriteByte(escapeChar)
+		}
+		buf.WriteByte(v[0])
+		v = v[1:]
+	}
+	if e.null != nil && bytes.Equal(buf.Bytes()[start:], e.null) {
+		escaped := append([]byte{escapeChar}, e.null...)
+		buf.Truncate(start)
+		buf.Write(escaped)
+	}
+}
+
+func (e *delimitedEncoding) decode(value []byte, columns []column) ([][]byte, error) {
+	if len(columns) == 1 && !e.escapeSingle() {
+		return [][]byte{e.nullable(value)}, nil
+	}
+	fields, err := e.split(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != len(columns) {
+		return nil, errMalformedValue
+	}
+	values := make([][]byte, len(fields))
+	for i, f := range fields {
+		if values[i] = e.nullable(f); values[i] != nil && e.escape {
+			values[i] = unescape(f)
+		}
+	}
+	return values, nil
+}
+
+// escapeSingle checks whether a single value is escaped, which is needed to distinguish it from the null token.
+func (e *delimitedEncoding) escapeSingle() bool {
+	return e.escape && e.null != nil
+}
+
+// split splits the value at separators which are not escaped, leaving the fields escaped.
+func (e *delimitedEncoding) split(value []byte) ([][]byte, error) {
+	if !e.escape {
+		return bytes.Split(value, e.separator), nil
+	}
+	var fields [][]byte
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == escapeChar:
+			if i+1 == len(value) {
+				return nil, errMalformedValue
+			}
+			i++
+		case bytes.HasPrefix(value[i:], e.separator):
+			fields = append(fields, value[start:i])
+			i += len(e.separator) - 1
+			start = i + 1
+		}
+	}
+	return append(fields, value[start:]), nil
+}
+
+// nullable returns nil if the field is the null token, the field itself otherwise.
+func (e *delimitedEncoding) nullable(field []byte) []byte {
+	if e.null != nil && bytes.Equal(field, e.null) {
+		return nil
+	}
+	if field == nil {
+		return []byte{}
+	}
+	return field
+}
+
+func unescape(field []byte) []byte {
+	value := make([]byte, 0, len(field))
+	for i := 0; i < len(field); i++ {
+		if field[i] == escapeChar {
+			i++
+		}
+		value = append(value, field[i])
+	}
+	return value
+}
+
+func (e *delimitedEncoding) flags() int {
+	return 0
+}
+
+// lengthPrefixedEncoding writes each value as a netstring, i.e. <length>:<value>, with
+// the length in decimal ASCII, so that values may contain arbitrary bytes. NULL is written as -1:.
+type lengthPrefixedEncoding struct{}
+
+// lengthPrefixedNull is the length prefix written for NULL, which has no value and no trailing comma.
+const lengthPrefixedNull = "-1:"
+
+func (lengthPrefixedEncoding) encode(_ []column, values [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, v := range values {
+		if v == nil {
+			buf.WriteString(lengthPrefixedNull)
+			continue
+		}
+		buf.WriteString(strconv.Itoa(len(v)))
+		buf.WriteByte(':')
+		buf.Write(v)
+		buf.WriteByte(',')
+	}
+	return buf.Bytes(), nil
+}
+
+func (lengthPrefixedEncoding) decode(value []byte, columns []column) ([][]byte, error) {
+	values := make([][]byte, 0, len(columns))
+	for len(value) > 0 {
+		if bytes.HasPrefix(value, []byte(lengthPrefixedNull)) {
+			values = append(values, nil)
+			value = value[len(lengthPrefixedNull):]
+			continue
+		}
+		colon := bytes.IndexByte(value, ':')
+		if colon < 0 {
+			return nil, errMalformedValue
+		}
+		n, err := strconv.Atoi(string(value[:colon]))
+		if err != nil || n < 0 || colon+1+n >= len(value) || value[colon+1+n] != ',' {
+			return nil, errMalformedValue
+		}
+		values = append(values, value[colon+1:colon+1+n])
+		value = value[colon+2+n:]
+	}
+	if len(values) != len(columns) {
+		return nil, errMalformedValue
+	}
+	return values, nil
+}
+
+func (lengthPrefixedEncoding) flags() int {
+	return FlagLengthPrefixed
+}
+
+// jsonEncoding writes values as a JSON object keyed by column names. Numeric columns are
+// written as numbers, binary columns as base64 encoded strings and NULL as null.
+type jsonEncoding struct{}
+
+func (jsonEncoding) encode(columns []column, values [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(c.name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		v := values[i]
+		switch {
+		case v == nil:
+			buf.WriteString("null")
+		case c.kind == kindNumber && json.Valid(v):
+			buf.Write(v)
+		case c.kind == kindBinary:
+			buf.WriteByte('"')
+			buf.WriteString(base64.StdEncoding.EncodeToString(v))
+			buf.WriteByte('"')
+		default:
+			s, err := json.Marshal(string(v))
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(s)
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (jsonEncoding) decode(value []byte, columns []column) ([][]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(value, &object); err != nil {
+		return nil, errMalformedValue
+	}
+	if len(object) != len(columns) {
+		return nil, errMalformedValue
+	}
+	values := make([][]byte, len(columns))
+	for i, c := range columns {
+		raw, ok := object[c.name]
+		if !ok {
+			return nil, errMalformedValue
+		}
+		switch raw[0] {
+		case 'n':
+			values[i] = nil
+		case '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, errMalformedValue
+			}
+			values[i] = []byte(s)
+			if c.kind == kindBinary {
+				b, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return nil, errMalformedValue
+				}
+				values[i] = b
+			}
+		case '{', '[':
+			return nil, errMalformedValue
+		default:
+			// Numbers and booleans are stored in their text form.
+			values[i] = []byte(raw)
+		}
+	}
+	return values, nil
+}
+
+func (jsonEncoding) flags() int {
+	return FlagJSON
+}
+
+// msgpackEncoding writes values as a MessagePack map keyed by column names. Integers and other
+// numbers are written as int64 and float64, binary columns as bin and NULL as nil.
+type msgpackEncoding struct{}
+
+func (msgpackEncoding) encode(columns []column, values [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := enc.EncodeMapLen(len(columns)); err != nil {
+		return nil, err
+	}
+	for i, c := range columns {
+		if err := enc.EncodeString(c.name); err != nil {
+			return nil, err
+		}
+		if err := encodeMsgpackValue(enc, c, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeMsgpackValue(enc *msgpack.Encoder, c column, v []byte) error {
+	if v == nil {
+		return enc.EncodeNil()
+	}
+	switch c.kind {
+	case kindNumber:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return enc.EncodeInt(n)
+		}
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return enc.EncodeFloat64(f)
+		}
+	case kindBinary:
+		return enc.EncodeBytes(v)
+	}
+	return enc.EncodeString(string(v))
+}
+
+func (msgpackEncoding) decode(value []byte, columns []column) ([][]byte, error) {
+	var object map[string]interface{}
+	if err := msgpack.Unmarshal(value, &object); err != nil {
+		return nil, errMalformedValue
+	}
+	if len(object) != len(columns) {
+		return nil, errMalformedValue
+	}
+	values := make([][]byte, len(columns))
+	for i, c := range columns {
+		v, ok := object[c.name]
+		if !ok {
+			return nil, errMalformedValue
+		}
+		switch v := v.(type) {
+		case nil:
+			values[i] = nil
+		case string:
+			values[i] = []byte(v)
+		case []byte:
+			values[i] = v
+		case bool, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+			values[i] = []byte(fmt.Sprint(v))
+		case float32:
+			values[i] = strconv.AppendFloat(nil, float64(v), 'g', -1, 32)
+		case float64:
+			values[i] = strconv.AppendFloat(nil, v, 'g', -1, 64)
+		default:
+			return nil, errMalformedValue
+		}
+	}
+	return values, nil
+}
+
+func (msgpackEncoding) flags() int {
+	return FlagMsgpack
+}
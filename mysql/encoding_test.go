@@ -0,0 +1,159 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_valueEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping config.Mapping
+		columns []column
+		values  [][]byte
+		want    string
+	}{
+		{
+			name:    "single binary value is passed through",
+			mapping: config.Mapping{Escape: true},
+			values:  [][]byte{{0x00, '|', 0xff, '\\'}},
+			want:    "\x00|\xff\\",
+		},
+		{
+			name:    "delimited",
+			mapping: config.Mapping{},
+			values:  [][]byte{[]byte("foo"), []byte(""), []byte("bar")},
+			want:    "foo||bar",
+		},
+		{
+			name:    "delimited with custom separator and escaping",
+			mapping: config.Mapping{Separator: "::", Escape: true},
+			values:  [][]byte{[]byte("a::b"), []byte(`c\`), []byte("d:e:")},
+			want:    `a\:\:b::c\\::d\:e\:`,
+		},
+		{
+			name:    "delimited with null token",
+			mapping: config.Mapping{NullToken: `\N`, Escape: true},
+			values:  [][]byte{nil, []byte(`\N`), {}},
+			want:    `\N|\\N|`,
+		},
+		{
+			name:    "single null value with null token",
+			mapping: config.Mapping{NullToken: `\N`},
+			values:  [][]byte{nil},
+			want:    `\N`,
+		},
+		{
+			name:    "single value equal to the null token is escaped",
+			mapping: config.Mapping{NullToken: `\N`, Escape: true},
+			values:  [][]byte{[]byte(`\N|`)},
+			want:    `\\N\|`,
+		},
+		{
+			name:    "values equal to a null token without backslash are escaped",
+			mapping: config.Mapping{NullToken: "NULL", Escape: true},
+			values:  [][]byte{[]byte("NULL"), nil, []byte("NULLS")},
+			want:    `\NULL|NULL|NULLS`,
+		},
+		{
+			name:    "single value equal to a null token without backslash is escaped",
+			mapping: config.Mapping{NullToken: "NULL", Escape: true},
+			values:  [][]byte{[]byte("NULL")},
+			want:    `\NULL`,
+		},
+		{
+			name:    "single null value with null token and escaping",
+			mapping: config.Mapping{NullToken: `\N`, Escape: true},
+			values:  [][]byte{nil},
+			want:    `\N`,
+		},
+		{
+			name:    "length-prefixed",
+			mapping: config.Mapping{Encoding: config.EncodingLengthPrefixed},
+			values:  [][]byte{[]byte("a,b"), {}, {0x00, ':'}},
+			want:    "3:a,b,0:,2:\x00:,",
+		},
+		{
+			name:    "length-prefixed with null",
+			mapping: config.Mapping{Encoding: config.EncodingLengthPrefixed},
+			values:  [][]byte{nil, {}, []byte("-1:"), nil},
+			want:    "-1:0:,3:-1:,-1:",
+		},
+		{
+			name:    "json",
+			mapping: config.Mapping{Encoding: config.EncodingJSON},
+			columns: []column{{name: "id", kind: kindNumber}, {name: "name"}, {name: "avatar", kind: kindBinary}, {name: "note"}},
+			values:  [][]byte{[]byte("42"), []byte(`"quoted"`), {0x00, 0xff}, nil},
+			want:    `{"id":42,"name":"\"quoted\"","avatar":"AP8=","note":null}`,
+		},
+		{
+			name:    "msgpack",
+			mapping: config.Mapping{Encoding: config.EncodingMsgpack},
+			columns: []column{{name: "id", kind: kindNumber}, {name: "score", kind: kindNumber}, {name: "avatar", kind: kindBinary}, {name: "note"}},
+			values:  [][]byte{[]byte("-7"), []byte("1.5"), {0x00, 0xff}, nil},
+			want:    "\x84\xa2id\xf9\xa5score\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00\xa6avatar\xc4\x02\x00\xff\xa4note\xc0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newValueEncoding(tt.mapping)
+			require.NoError(t, err)
+			columns := tt.columns
+			if columns == nil {
+				columns = make([]column, len(tt.values))
+			}
+			got, err := e.encode(columns, tt.values)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(got))
+			decoded, err := e.decode(got, columns)
+			require.NoError(t, err)
+			require.Equal(t, tt.values, decoded)
+		})
+	}
+}
+
+func Test_valueEncoding_decodeMalformed(t *testing.T) {
+	delimited, err := newValueEncoding(config.Mapping{Escape: true})
+	require.NoError(t, err)
+	lengthPrefixed, err := newValueEncoding(config.Mapping{Encoding: config.EncodingLengthPrefixed})
+	require.NoError(t, err)
+	jsonObject, err := newValueEncoding(config.Mapping{Encoding: config.EncodingJSON})
+	require.NoError(t, err)
+	msgpackMap, err := newValueEncoding(config.Mapping{Encoding: config.EncodingMsgpack})
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		encoding valueEncoding
+		value    string
+	}{
+		{delimited, "a|b|c"},
+		{delimited, `a|b\`},
+		{lengthPrefixed, "3:ab,"},
+		{lengthPrefixed, "1:a"},
+		{lengthPrefixed, "1:a,"},
+		{lengthPrefixed, "-2:,1:a,"},
+		{jsonObject, `{"a":1}`},
+		{jsonObject, `{"a":1,"c":2}`},
+		{jsonObject, `{"a":1,"b":[2]}`},
+		{jsonObject, `[1,2]`},
+		{msgpackMap, "\x81\xa1a\x01"},
+		{msgpackMap, "\x92\x01\x02"},
+	} {
+		_, err := tt.encoding.decode([]byte(tt.value), []column{{name: "a"}, {name: "b"}})
+		require.ErrorIs(t, err, errMalformedValue, tt.value)
+	}
+}
+
+func FuzzLengthPrefixedEncoding(f *testing.F) {
+	f.Add([]byte("foo"), []byte("b,a:r"))
+	f.Fuzz(func(t *testing.T, a, b []byte) {
+		e := lengthPrefixedEncoding{}
+		value, err := e.encode(nil, [][]byte{a, b})
+		require.NoError(t, err)
+		values, err := e.decode(value, make([]column, 2))
+		require.NoError(t, err)
+		require.Equal(t, string(a), string(values[0]))
+		require.Equal(t, string(b), string(values[1]))
+	})
+}
@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coufalja/memcached-mysql/config"
+)
+
+// keyTransform is a step of the pipeline transforming memcached keys into table keys.
+type keyTransform func(string) (string, error)
+
+// keyPipeline transforms keys by its steps in order. Integer keys are bound as integers.
+type keyPipeline struct {
+	steps   []keyTransform
+	integer bool
+}
+
+func newKeyPipeline(transforms []config.KeyTransform) (keyPipeline, error) {
+	var p keyPipeline
+	for i, t := range transforms {
+		switch {
+		case t.StripPrefix != "":
+			prefix := t.StripPrefix
+			p.steps = append(p.steps, func(key string) (string, error) {
+				if !strings.HasPrefix(key, prefix) {
+					return "", errBadKeyFormat
+				}
+				return strings.TrimPrefix(key, prefix), nil
+			})
+		case t.Regex != "":
+			re, err := regexp.Compile(t.Regex)
+			if err != nil {
+				return p, err
+			}
+			if re.NumSubexp() == 0 {
+				return p, fmt.Errorf("regex %q has no capture group", t.Regex)
+			}
+			p.steps = append(p.steps, func(key string) (string, error) {
+				match := re.FindStringSubmatch(key)
+				if match == nil {
+					return "", errBadKeyFormat
+				}
+				return match[1], nil
+			})
+		case t.Case == config.CaseLower:
+			p.steps = append(p.steps, func(key string) (string, error) { return strings.ToLower(key), nil })
+		case t.Case == config.CaseUpper:
+			p.steps = append(p.steps, func(key string) (string, error) { return strings.ToUpper(key), nil })
+		case t.Hash == config.HashSHA1:
+			p.steps = append(p.steps, func(key string) (string, error) {
+				sum := sha1.Sum([]byte(key))
+				return hex.EncodeToString(sum[:]), nil
+			})
+		case t.Hash == config.HashSHA256:
+			p.steps = append(p.steps, func(key string) (string, error) {
+				sum := sha256.Sum256([]byte(key))
+				return hex.EncodeToString(sum[:]), nil
+			})
+		case t.Integer:
+			if i != len(transforms)-1 {
+				return p, errors.New("integer has to be the last key transform")
+			}
+			p.integer = true
+			p.steps = append(p.steps, func(key string) (string, error) {
+				n, err := strconv.ParseInt(key, 10, 64)
+				if err != nil {
+					return "", errBadKeyFormat
+				}
+				return strconv.FormatInt(n, 10), nil
+			})
+		default:
+			return p, fmt.Errorf("invalid key transform %+v", t)
+		}
+	}
+	return p, nil
+}
+
+func (p keyPipeline) apply(key string) (string, error) {
+	for _, step := range p.steps {
+		var err error
+		if key, err = step(key); err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
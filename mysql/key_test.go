@@ -0,0 +1,74 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_keyPipeline(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []config.KeyTransform
+		key        string
+		want       string
+		wantErr    error
+	}{
+		{
+			name: "no transforms",
+			key:  "user:v2:123",
+			want: "user:v2:123",
+		},
+		{
+			name:       "strip prefix and coerce to integer",
+			transforms: []config.KeyTransform{{StripPrefix: "user:v2:"}, {Integer: true}},
+			key:        "user:v2:0123",
+			want:       "123",
+		},
+		{
+			name:       "missing prefix",
+			transforms: []config.KeyTransform{{StripPrefix: "user:v2:"}},
+			key:        "user:v1:123",
+			wantErr:    errBadKeyFormat,
+		},
+		{
+			name:       "regex capture and case folding",
+			transforms: []config.KeyTransform{{Regex: `^session:([^:]+):data$`}, {Case: config.CaseUpper}},
+			key:        "session:ab12:data",
+			want:       "AB12",
+		},
+		{
+			name:       "regex not matching",
+			transforms: []config.KeyTransform{{Regex: `^session:(\w+)$`}},
+			key:        "user:1",
+			wantErr:    errBadKeyFormat,
+		},
+		{
+			name:       "sha1 hash of a lower-cased key",
+			transforms: []config.KeyTransform{{Case: config.CaseLower}, {Hash: config.HashSHA1}},
+			key:        "FOO",
+			want:       "0beec7b5ea3f0fdbc95d0dd47f3c5bc275da8a33",
+		},
+		{
+			name:       "not an integer",
+			transforms: []config.KeyTransform{{Integer: true}},
+			key:        "12a",
+			wantErr:    errBadKeyFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newKeyPipeline(tt.transforms)
+			require.NoError(t, err)
+			got, err := p.apply(tt.key)
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_newKeyPipeline_integerNotLast(t *testing.T) {
+	_, err := newKeyPipeline([]config.KeyTransform{{Integer: true}, {Hash: config.HashSHA1}})
+	require.Error(t, err)
+}
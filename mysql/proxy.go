@@ -5,11 +5,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coufalja/memcached-mysql/config"
 	"github.com/coufalja/memcached-mysql/memcached"
+	"go.uber.org/zap"
 )
 
 const (
@@ -17,21 +20,86 @@ const (
 	mappingSep         = "."
 	defaultMapping     = "default"
 	valueSeparator     = "|"
+	keyDelimiter       = ":"
+	lookupSep          = ":"
 	columnSeparator    = ","
 	tableNameSeparator = "."
+	accessDenied       = "access denied"
+)
+
+var (
+	errBadKeyFormat  = errors.New("bad key format")
+	errNotWritable   = errors.New("mapping does not accept writes")
+	errNotScannable  = errors.New("mapping does not support scans")
+	errUnknownLookup = errors.New("unknown lookup column")
 )
 
 type Proxy struct {
-	tables map[string]*tableProxy
+	// Logger receives audit records of denied requests.
+	Logger *zap.Logger
+	// MappingSeparator ends the mapping name in keys of the form @@<mapping><separator><key>, . by default.
+	MappingSeparator string
+	tables           map[string]*tableProxy
+	routes           *router
+}
+
+// SetRoutes routes keys without the @@<mapping>. syntax to mappings by prefixes and regular expressions.
+func (c *Proxy) SetRoutes(routes []config.Route) error {
+	for _, r := range routes {
+		if _, ok := c.tables[r.Mapping]; !ok {
+			return fmt.Errorf("route to unknown mapping %s", r.Mapping)
+		}
+	}
+	router, err := newRouter(routes)
+	if err != nil {
+		return err
+	}
+	c.routes = router
+	return nil
+}
+
+// resolve returns the mapping of the key and the key within the mapping.
+func (c *Proxy) resolve(key string) (string, string, error) {
+	if !strings.HasPrefix(key, mappingPrefix) && c.routes != nil {
+		if mapping, ok := c.routes.route(key); ok {
+			return mapping, key, nil
+		}
+	}
+	sep := c.MappingSeparator
+	if sep == "" {
+		sep = mappingSep
+	}
+	return mappingKey(key, sep)
 }
 
 func (c *Proxy) Get(key string) memcached.MemcachedResponse {
-	mapping, ckey, err := mappingKey(key)
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext looks the key up in the mapped table. The context carries
+// the memcached.Client the request originates from.
+func (c *Proxy) GetContext(ctx context.Context, key string) memcached.MemcachedResponse {
+	mapping, ckey, err := c.resolve(key)
 	if err != nil {
 		return &memcached.ClientErrorResponse{Reason: err.Error()}
 	}
-	if proxy, ok := c.tables[mapping]; ok {
-		item, err := proxy.Get(ckey)
+	proxy, ok := c.tables[mapping]
+	var lookup string
+	if !ok {
+		// @@<mapping>:<column>.<key> looks the key up by a secondary column of the mapping.
+		mapping, lookup, _ = strings.Cut(mapping, lookupSep)
+		proxy, ok = c.tables[mapping]
+	}
+	if ok {
+		if err := c.authorize(ctx, mapping, proxy, permRead, key); err != nil {
+			return &memcached.ClientErrorResponse{Reason: err.Error()}
+		}
+		var item *memcached.Item
+		if lookup != "" {
+			item, err = proxy.Lookup(ctx, lookup, ckey)
+		} else {
+			item, err = proxy.Get(ctx, ckey)
+		}
 		if err != nil {
 			return &memcached.ClientErrorResponse{Reason: err.Error()}
 		}
@@ -44,29 +112,144 @@ func (c *Proxy) Get(key string) memcached.MemcachedResponse {
 	return nil
 }
 
-func mappingKey(key string) (string, string, error) {
-	if strings.HasPrefix(key, mappingPrefix) {
-		sep := strings.Split(key, mappingSep)
-		if len(sep) < 2 {
-			return "", "", errors.New("bad key format")
+func (c *Proxy) Set(item *memcached.Item) memcached.MemcachedResponse {
+	return c.SetContext(context.Background(), item)
+}
+
+// SetContext decodes the item value in the encoding of the mapping and writes it
+// to the mapped table, inserting the row if it does not exist.
+func (c *Proxy) SetContext(ctx context.Context, item *memcached.Item) memcached.MemcachedResponse {
+	mapping, ckey, err := c.resolve(item.Key)
+	if err != nil {
+		return &memcached.ClientErrorResponse{Reason: err.Error()}
+	}
+	proxy, ok := c.tables[mapping]
+	if !ok {
+		return &memcached.StatusResponse{Status: memcached.StatusNotStored}
+	}
+	if err := c.authorize(ctx, mapping, proxy, permWrite, item.Key); err != nil {
+		return &memcached.ClientErrorResponse{Reason: err.Error()}
+	}
+	if err := proxy.Set(ctx, ckey, item.Value, item.Flags); err != nil {
+		switch {
+		case errors.Is(err, errMalformedValue), errors.Is(err, errBadKeyFormat):
+			return &memcached.ClientErrorResponse{Reason: err.Error()}
+		case errors.Is(err, errNotWritable):
+			return &memcached.StatusResponse{Status: memcached.StatusNotStored}
+		case errors.Is(err, errQueueFull):
+			return &memcached.StatusResponse{Status: fmt.Sprintf(memcached.StatusServerErrorMessage, err)}
+		}
+		c.Logger.Error("failed to write item", zap.String("mapping", mapping), zap.String("key", item.Key), zap.Error(err))
+		return &memcached.StatusResponse{Status: memcached.StatusServerError}
+	}
+	return nil
+}
+
+func (c *Proxy) Scan(cmd *memcached.ScanCmd) memcached.MemcachedResponse {
+	return c.ScanContext(context.Background(), cmd)
+}
+
+// ScanContext returns items of a mapping with keys starting with a prefix or within a range.
+// Both ends of a range have to resolve to the same mapping. Item keys carry the mapping the same way the request does.
+func (c *Proxy) ScanContext(ctx context.Context, cmd *memcached.ScanCmd) memcached.MemcachedResponse {
+	key := cmd.Prefix
+	if cmd.Kind == memcached.ScanRange {
+		key = cmd.From
+	}
+	mapping, a, err := c.resolve(key)
+	if err != nil {
+		return &memcached.ClientErrorResponse{Reason: err.Error()}
+	}
+	var b string
+	if cmd.Kind == memcached.ScanRange {
+		var toMapping string
+		if toMapping, b, err = c.resolve(cmd.To); err != nil {
+			return &memcached.ClientErrorResponse{Reason: err.Error()}
+		}
+		if toMapping != mapping {
+			return &memcached.ClientErrorResponse{Reason: "range spans multiple mappings"}
 		}
-		return strings.TrimLeft(sep[0], "@"), sep[1], nil
 	}
-	return defaultMapping, key, nil
+	proxy, ok := c.tables[mapping]
+	if !ok {
+		return nil
+	}
+	if err := c.authorize(ctx, mapping, proxy, permRead, key); err != nil {
+		return &memcached.ClientErrorResponse{Reason: err.Error()}
+	}
+	items, err := proxy.Scan(ctx, cmd.Kind, a, b, cmd.Limit)
+	if err != nil {
+		return &memcached.ClientErrorResponse{Reason: err.Error()}
+	}
+	// The mapping part of the requested key, e.g. @@users., prefixes keys of the rows.
+	prefix := key[:len(key)-len(a)]
+	response := &memcached.BulkResponse{Responses: make([]memcached.MemcachedResponse, len(items))}
+	for i, item := range items {
+		item.Key = prefix + item.Key
+		response.Responses[i] = &memcached.ItemResponse{Item: item}
+	}
+	return response
+}
+
+// mappingKey splits keys of the form @@<mapping><sep><key>, everything after the first separator is the key.
+// Keys without the @@ prefix belong to the default mapping.
+func mappingKey(key, sep string) (string, string, error) {
+	if !strings.HasPrefix(key, mappingPrefix) {
+		return defaultMapping, key, nil
+	}
+	mapping, ckey, ok := strings.Cut(strings.TrimPrefix(key, mappingPrefix), sep)
+	if !ok || mapping == "" || ckey == "" {
+		return "", "", errBadKeyFormat
+	}
+	return mapping, ckey, nil
 }
 
-func New(db *sql.DB, mapping []config.Mapping) *Proxy {
+// New creates a Proxy serving the mappings, statements of the mappings are prepared
+// and errors are returned wrapped with the name of the mapping.
+func New(db *sql.DB, mapping []config.Mapping) (*Proxy, error) {
 	proxy := &Proxy{
-		tables: make(map[string]*tableProxy),
+		Logger:           zap.NewNop(),
+		MappingSeparator: mappingSep,
+		tables:           make(map[string]*tableProxy),
 	}
 	for _, m := range mapping {
 		tp, err := newTable(db, m)
 		if err != nil {
-			panic(err)
+			proxy.Close()
+			return nil, fmt.Errorf("mapping %s: %w", m.Name, err)
+		}
+		if tp.writes != nil {
+			name := m.Name
+			tp.writes.onError = func(err error, rows int) {
+				proxy.Logger.Error("failed to flush buffered writes", zap.String("mapping", name), zap.Int("rows", rows), zap.Error(err))
+			}
 		}
 		proxy.tables[m.Name] = tp
 	}
-	return proxy
+	return proxy, nil
+}
+
+// Stats returns write-behind metrics of mappings, named write_behind_<mapping>_<metric>.
+func (c *Proxy) Stats() map[string]fmt.Stringer {
+	stats := make(map[string]fmt.Stringer)
+	for name, tp := range c.tables {
+		if tp.writes == nil {
+			continue
+		}
+		for k, v := range tp.writes.stats("write_behind_" + name + "_") {
+			stats[k] = v
+		}
+	}
+	return stats
+}
+
+// Close flushes buffered writes of all mappings.
+func (c *Proxy) Close() {
+	for _, tp := range c.tables {
+		if tp.writes != nil {
+			tp.writes.Close()
+		}
+	}
 }
 
 func backtickSlice(elems []string) []string {
@@ -83,52 +266,401 @@ func backtick(elem string) string {
 	return fmt.Sprintf("`%s`", elem)
 }
 
-func formatSelectQuery(columns []string, table, keyColumn string) string {
+func formatSelectQuery(columns []string, table string, keyColumns []string) string {
 	return fmt.Sprintf(
-		"SELECT %s FROM %s WHERE %s=?",
+		"SELECT %s FROM %s WHERE %s",
 		strings.Join(backtickSlice(columns), columnSeparator),                                     // []string{"column1", "column2"} -> "`column1`,`column2`"
 		strings.Join(backtickSlice(strings.Split(table, tableNameSeparator)), tableNameSeparator), // "database.table" ~> "`database`.`table`"
+		formatKeyCondition(keyColumns),                                                            // []string{"a", "b"} -> "`a`=? AND `b`=?"
+	)
+}
+
+func formatKeyCondition(keyColumns []string) string {
+	conditions := make([]string, len(keyColumns))
+	for i, c := range backtickSlice(keyColumns) {
+		conditions[i] = c + "=?"
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// formatUpsertQuery formats an INSERT ... ON DUPLICATE KEY UPDATE statement of the given number of rows.
+func formatUpsertQuery(columns []string, table string, keyColumns []string, rows int) string {
+	assignments := make([]string, len(columns))
+	for i, c := range backtickSlice(columns) {
+		assignments[i] = fmt.Sprintf("%s=VALUES(%s)", c, c)
+	}
+	row := "(" + strings.TrimSuffix(strings.Repeat("?"+columnSeparator, len(keyColumns)+len(columns)), columnSeparator) + ")"
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s ON DUPLICATE KEY UPDATE %s",
+		strings.Join(backtickSlice(strings.Split(table, tableNameSeparator)), tableNameSeparator),
+		strings.Join(backtickSlice(append(append([]string{}, keyColumns...), columns...)), columnSeparator),
+		strings.TrimSuffix(strings.Repeat(row+columnSeparator, rows), columnSeparator),
+		strings.Join(assignments, columnSeparator),
+	)
+}
+
+func formatScanQuery(columns []string, table, keyColumn, condition string) string {
+	return fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s %s ORDER BY %s LIMIT ?",
+		strings.Join(backtickSlice(append([]string{keyColumn}, columns...)), columnSeparator),
+		strings.Join(backtickSlice(strings.Split(table, tableNameSeparator)), tableNameSeparator),
+		backtick(keyColumn),
+		condition,
 		backtick(keyColumn),
 	)
 }
 
 func newTable(db *sql.DB, m config.Mapping) (*tableProxy, error) {
 	columns := strings.Split(m.ValueColumn, valueSeparator)
-	stmt, err := db.Prepare(formatSelectQuery(columns, m.Table, m.KeyColumn))
+	keyColumns := strings.Split(m.KeyColumn, valueSeparator)
+	keyDelim := m.KeyDelimiter
+	if keyDelim == "" {
+		keyDelim = keyDelimiter
+	}
+	acl, err := newAccessList(m.ACL)
+	if err != nil {
+		return nil, err
+	}
+	encoding, err := newValueEncoding(m)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := newKeyPipeline(m.KeyTransform)
+	if err != nil {
+		return nil, err
+	}
+	query, upsertQuery := m.Query, m.WriteQuery
+	if query == "" {
+		query = formatSelectQuery(columns, m.Table, keyColumns)
+	}
+	if upsertQuery == "" && m.Table != "" {
+		upsertQuery = formatUpsertQuery(columns, m.Table, keyColumns, 1)
+	}
+	// Scans are supported over plain keys only, as transformed and composite keys cannot be ordered as requested.
+	var scanPrefixQuery, scanRangeQuery string
+	if m.Query == "" && len(keyColumns) == 1 && len(m.KeyTransform) == 0 {
+		scanPrefixQuery = formatScanQuery(columns, m.Table, keyColumns[0], "LIKE ?")
+		scanRangeQuery = formatScanQuery(columns, m.Table, keyColumns[0], "BETWEEN ? AND ?")
+	}
+	stmt, err := db.Prepare(query)
 	if err != nil {
 		return nil, err
 	}
-	return &tableProxy{query: stmt, columns: columns}, nil
+	lookups := make(map[string]*sql.Stmt, len(m.Lookups))
+	for _, column := range m.Lookups {
+		if lookups[column], err = db.Prepare(formatSelectQuery(columns, m.Table, []string{column})); err != nil {
+			return nil, fmt.Errorf("lookup %s: %w", column, err)
+		}
+	}
+	tp := &tableProxy{
+		db:              db,
+		query:           stmt,
+		lookups:         lookups,
+		upsertQuery:     upsertQuery,
+		scanPrefixQuery: scanPrefixQuery,
+		scanRangeQuery:  scanRangeQuery,
+		keyColumns:      keyColumns,
+		keyDelim:        keyDelim,
+		keys:            keys,
+		columns:         columns,
+		encoding:        encoding,
+		acl:             acl,
+		readOnly:        m.ReadOnly,
+		nullFlag:        m.NullFlag,
+	}
+	if m.WriteBehind.Enabled {
+		tp.writes = newWriteBehind(db, m.WriteBehind, func(rows int) string {
+			return formatUpsertQuery(columns, m.Table, keyColumns, rows)
+		})
+	}
+	if m.Query != "" {
+		// Run the custom query with NULL keys to check it returns the value columns.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := tp.valueColumns(ctx); err != nil {
+			return nil, fmt.Errorf("query: %w", err)
+		}
+	}
+	return tp, nil
 }
 
 type tableProxy struct {
-	query   *sql.Stmt
-	columns []string
+	db          *sql.DB
+	query       *sql.Stmt
+	upsertQuery string
+	// lookups are queries by secondary unique columns.
+	lookups    map[string]*sql.Stmt
+	keyColumns []string
+	keyDelim   string
+	keys       keyPipeline
+	columns    []string
+	encoding   valueEncoding
+	acl        accessList
+	readOnly   bool
+	nullFlag   bool
+	// writes buffers sets if write-behind is enabled.
+	writes *writeBehind
+
+	// scan queries are empty if the mapping does not support scans.
+	scanPrefixQuery string
+	scanRangeQuery  string
+
+	// stmts are prepared on the first use, so that e.g. read-only mappings never prepare writes.
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+	// kinds of value columns are learned from the first result set.
+	kinds []columnKind
+}
+
+func (c *tableProxy) Get(ctx context.Context, key string) (*memcached.Item, error) {
+	args, err := c.keyArgs(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.get(ctx, c.query, args)
 }
 
-func (c *tableProxy) Get(key string) (*memcached.Item, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// Lookup looks the key up by a secondary unique column. The key is used as is, without key transforms.
+func (c *tableProxy) Lookup(ctx context.Context, column, key string) (*memcached.Item, error) {
+	stmt, ok := c.lookups[column]
+	if !ok {
+		return nil, errUnknownLookup
+	}
+	return c.get(ctx, stmt, []interface{}{key})
+}
+
+func (c *tableProxy) get(ctx context.Context, stmt *sql.Stmt, args []interface{}) (*memcached.Item, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
-	row := c.query.QueryRowContext(ctx, key)
-	if row.Err() != nil {
-		return nil, row.Err()
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := c.resultColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
 	}
-	container := make([]sql.NullString, len(c.columns))
+	// Scan into raw bytes so that binary values are not altered, NULL is scanned as nil.
+	container := make([][]byte, len(c.columns))
 	pointers := make([]interface{}, len(c.columns))
 	for i := range pointers {
 		pointers[i] = &container[i]
 	}
-	if err := row.Scan(pointers...); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+	return c.newItem(columns, container)
+}
+
+func (c *tableProxy) newItem(columns []column, values [][]byte) (*memcached.Item, error) {
+	if c.nullFlag && allNull(values) {
+		return &memcached.Item{Value: []byte{}, Flags: c.encoding.flags() | FlagNull}, nil
+	}
+	value, err := c.encoding.encode(columns, values)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return &memcached.Item{Value: value, Flags: c.encoding.flags()}, nil
+}
+
+// Scan returns items of rows with keys starting with the prefix, or within the inclusive range from a to b,
+// ordered by key. Item keys are the keys of the rows.
+func (c *tableProxy) Scan(ctx context.Context, kind, a, b string, limit int) ([]*memcached.Item, error) {
+	if c.scanPrefixQuery == "" {
+		return nil, errNotScannable
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	columns, err := c.valueColumns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, args := c.scanPrefixQuery, []interface{}{escapeLike(a) + "%", limit}
+	if kind == memcached.ScanRange {
+		query, args = c.scanRangeQuery, []interface{}{a, b, limit}
+	}
+	stmt, err := c.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*memcached.Item
+	for rows.Next() {
+		var key string
+		container := make([][]byte, len(c.columns))
+		pointers := make([]interface{}, len(c.columns)+1)
+		pointers[0] = &key
+		for i := range container {
+			pointers[i+1] = &container[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
 		}
+		item, err := c.newItem(columns, container)
+		if err != nil {
+			return nil, err
+		}
+		item.Key = key
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// escapeLike escapes wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Set decodes the value into the value columns and inserts or updates the row of the key.
+// With the null flag enabled, values flagged by FlagNull set all value columns to NULL.
+func (c *tableProxy) Set(ctx context.Context, key string, value []byte, flags int) error {
+	args, err := c.keyArgs(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	values := make([][]byte, len(c.columns))
+	if !c.nullFlag || flags&FlagNull == 0 {
+		columns, err := c.valueColumns(ctx)
+		if err != nil {
+			return err
+		}
+		if values, err = c.encoding.decode(value, columns); err != nil {
+			return err
+		}
+	}
+	if c.upsertQuery == "" {
+		return errNotWritable
+	}
+	key = batchKey(args)
+	for _, v := range values {
+		if v == nil {
+			args = append(args, nil)
+			continue
+		}
+		args = append(args, v)
+	}
+	if c.writes != nil {
+		return c.writes.enqueue(ctx, key, args)
+	}
+	stmt, err := c.prepare(ctx, c.upsertQuery)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, args...)
+	return err
+}
+
+// keyArgs transforms the key and splits it into parts of a composite key, the last part takes the rest of the key.
+func (c *tableProxy) keyArgs(key string) ([]interface{}, error) {
+	key, err := c.keys.apply(key)
+	if err != nil {
 		return nil, err
 	}
-	values := make([]string, len(c.columns))
-	for i, c := range container {
-		if c.Valid {
-			values[i] = c.String
+	if c.keys.integer {
+		n, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, errBadKeyFormat
+		}
+		return []interface{}{n}, nil
+	}
+	if len(c.keyColumns) == 1 {
+		return []interface{}{key}, nil
+	}
+	parts := strings.SplitN(key, c.keyDelim, len(c.keyColumns))
+	if len(parts) != len(c.keyColumns) {
+		return nil, errBadKeyFormat
+	}
+	args := make([]interface{}, len(parts))
+	for i, p := range parts {
+		args[i] = p
+	}
+	return args, nil
+}
+
+func allNull(values [][]byte) bool {
+	for _, v := range values {
+		if v != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// prepare returns the statement of the query, preparing it on the first use.
+func (c *tableProxy) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if c.stmts == nil {
+		c.stmts = make(map[string]*sql.Stmt)
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// resultColumns describes the value columns using the column types of the result set.
+func (c *tableProxy) resultColumns(rows *sql.Rows) ([]column, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.kinds == nil {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return nil, err
+		}
+		if len(types) != len(c.columns) {
+			return nil, fmt.Errorf("returns %d columns, expected %d value columns", len(types), len(c.columns))
+		}
+		kinds := make([]columnKind, len(types))
+		for i, t := range types {
+			kinds[i] = kindOf(t.DatabaseTypeName())
+		}
+		c.kinds = kinds
+	}
+	return c.describe(c.kinds), nil
+}
+
+// valueColumns describes the value columns, querying an empty result set for their types if not yet known.
+func (c *tableProxy) valueColumns(ctx context.Context) ([]column, error) {
+	c.mu.Lock()
+	kinds := c.kinds
+	c.mu.Unlock()
+	if kinds != nil {
+		return c.describe(kinds), nil
+	}
+	rows, err := c.query.QueryContext(ctx, make([]interface{}, len(c.keyColumns))...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return c.resultColumns(rows)
+}
+
+func (c *tableProxy) describe(kinds []columnKind) []column {
+	columns := make([]column, len(c.columns))
+	for i, name := range c.columns {
+		columns[i] = column{name: name}
+		if i < len(kinds) {
+			columns[i].kind = kinds[i]
 		}
 	}
-	return &memcached.Item{Value: []byte(strings.Join(values, valueSeparator))}, nil
+	return columns
 }
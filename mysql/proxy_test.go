@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"testing"
@@ -16,9 +17,10 @@ func TestNew(t *testing.T) {
 		mapping []config.Mapping
 	}
 	tests := []struct {
-		name string
-		args args
-		mock func(sqlmock.Sqlmock)
+		name    string
+		args    args
+		mock    func(sqlmock.Sqlmock)
+		wantErr string
 	}{
 		{
 			name: "empty mapping",
@@ -65,6 +67,23 @@ func TestNew(t *testing.T) {
 				s.ExpectPrepare("SELECT `value` FROM `test2` WHERE `key`=?")
 			},
 		},
+		{
+			name: "missing column",
+			args: args{
+				mapping: []config.Mapping{
+					{
+						Name:        "test",
+						KeyColumn:   "key",
+						ValueColumn: "missing",
+						Table:       "test",
+					},
+				},
+			},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `missing` FROM `test` WHERE `key`=?").WillReturnError(errors.New("Unknown column 'missing'"))
+			},
+			wantErr: "mapping test: Unknown column 'missing'",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -73,9 +92,61 @@ func TestNew(t *testing.T) {
 				tt.mock(mock)
 			}
 			require.NoError(t, err)
-			require.NotPanics(t, func() {
-				New(db, tt.args.mapping)
-			})
+			_, err = New(db, tt.args.mapping)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_newTable_customQuery(t *testing.T) {
+	const query = "SELECT u.`name`, COUNT(o.`id`) FROM `users` u LEFT JOIN `orders` o ON o.`user_id`=u.`id` WHERE u.`id`=? AND u.`deleted_at` IS NULL GROUP BY u.`id`"
+	mapping := config.Mapping{
+		Name:        "users",
+		KeyColumn:   "id",
+		ValueColumn: "name|orders",
+		Query:       query,
+		Encoding:    config.EncodingJSON,
+	}
+	tests := []struct {
+		name    string
+		columns []*sqlmock.Column
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			name: "query returns value columns",
+			columns: []*sqlmock.Column{
+				sqlmock.NewColumn("name").OfType("VARCHAR", ""),
+				sqlmock.NewColumn("COUNT(o.`id`)").OfType("BIGINT", int64(0)),
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name:    "query returns too few columns",
+			columns: []*sqlmock.Column{sqlmock.NewColumn("name")},
+			wantErr: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, s, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			require.NoError(t, err)
+			s.ExpectPrepare(query)
+			s.ExpectQuery(query).WithArgs(nil).WillReturnRows(sqlmock.NewRowsWithColumnDefinition(tt.columns...))
+			c, err := newTable(db, mapping)
+			tt.wantErr(t, err)
+			require.NoError(t, s.ExpectationsWereMet())
+			if err != nil {
+				return
+			}
+			s.ExpectQuery(query).WithArgs("1").WillReturnRows(sqlmock.NewRowsWithColumnDefinition(tt.columns...).AddRow("joe", int64(3)))
+			got, err := c.Get(context.Background(), "1")
+			require.NoError(t, err)
+			require.Equal(t, `{"name":"joe","orders":3}`, string(got.Value))
+			require.ErrorIs(t, c.Set(context.Background(), "1", got.Value, 0), errNotWritable)
 		})
 	}
 }
@@ -172,6 +243,85 @@ func TestProxy_Get(t *testing.T) {
 				Value: []byte("bar"),
 			}},
 		},
+		{
+			name: "scoped key containing dots",
+			fields: fields{mappings: []config.Mapping{
+				{
+					Name:        "users",
+					KeyColumn:   "email",
+					ValueColumn: "name",
+					Table:       "users",
+				},
+			}},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `name` FROM `users` WHERE `email`=?")
+				s.ExpectQuery("SELECT `name` FROM `users` WHERE `email`=.+").WithArgs("john.doe@example.com").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("John"))
+			},
+			args: args{key: "@@users.john.doe@example.com"},
+			want: &memcached.ItemResponse{Item: &memcached.Item{
+				Key:   "@@users.john.doe@example.com",
+				Value: []byte("John"),
+			}},
+		},
+		{
+			name: "lookup by secondary column",
+			fields: fields{mappings: []config.Mapping{
+				{
+					Name:        "users",
+					KeyColumn:   "id",
+					ValueColumn: "name",
+					Table:       "users",
+					Lookups:     []string{"email"},
+				},
+			}},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `name` FROM `users` WHERE `id`=?")
+				s.ExpectPrepare("SELECT `name` FROM `users` WHERE `email`=?")
+				s.ExpectQuery("SELECT `name` FROM `users` WHERE `email`=.+").WithArgs("foo@x.com").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Foo"))
+			},
+			args: args{key: "@@users:email.foo@x.com"},
+			want: &memcached.ItemResponse{Item: &memcached.Item{
+				Key:   "@@users:email.foo@x.com",
+				Value: []byte("Foo"),
+			}},
+		},
+		{
+			name: "unknown lookup column",
+			fields: fields{mappings: []config.Mapping{
+				{
+					Name:        "users",
+					KeyColumn:   "id",
+					ValueColumn: "name",
+					Table:       "users",
+				},
+			}},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `name` FROM `users` WHERE `id`=?")
+			},
+			args: args{key: "@@users:phone.123"},
+			want: &memcached.ClientErrorResponse{Reason: errUnknownLookup.Error()},
+		},
+		{
+			name: "transformed key is echoed as requested",
+			fields: fields{mappings: []config.Mapping{
+				{
+					Name:         "default",
+					KeyColumn:    "id",
+					ValueColumn:  "name",
+					Table:        "users",
+					KeyTransform: []config.KeyTransform{{StripPrefix: "user:v2:"}, {Integer: true}},
+				},
+			}},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `name` FROM `users` WHERE `id`=?")
+				s.ExpectQuery("SELECT `name` FROM `users` WHERE `id`=.+").WithArgs(int64(123)).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("joe"))
+			},
+			args: args{key: "user:v2:123"},
+			want: &memcached.ItemResponse{Item: &memcached.Item{
+				Key:   "user:v2:123",
+				Value: []byte("joe"),
+			}},
+		},
 		{
 			name: "unknown key prefix",
 			fields: fields{mappings: []config.Mapping{
@@ -203,7 +353,8 @@ func TestProxy_Get(t *testing.T) {
 			if tt.mock != nil {
 				tt.mock(s)
 			}
-			c := New(db, tt.fields.mappings)
+			c, err := New(db, tt.fields.mappings)
+			require.NoError(t, err)
 			got := c.Get(tt.args.key)
 			require.Equal(t, tt.want, got)
 		})
@@ -213,6 +364,7 @@ func TestProxy_Get(t *testing.T) {
 func Test_mappingKey(t *testing.T) {
 	type args struct {
 		key string
+		sep string
 	}
 	tests := []struct {
 		name         string
@@ -223,26 +375,65 @@ func Test_mappingKey(t *testing.T) {
 	}{
 		{
 			name:         "plain key",
-			args:         args{key: "key"},
+			args:         args{key: "key", sep: "."},
 			wantMapping:  defaultMapping,
 			wantPlainKey: "key",
 		},
+		{
+			name:         "plain key with separator",
+			args:         args{key: "john.doe", sep: "."},
+			wantMapping:  defaultMapping,
+			wantPlainKey: "john.doe",
+		},
 		{
 			name:         "scoped key",
-			args:         args{key: "@@aa.key"},
+			args:         args{key: "@@aa.key", sep: "."},
 			wantMapping:  "aa",
 			wantPlainKey: "key",
 		},
+		{
+			name:         "scoped key containing separators",
+			args:         args{key: "@@users.john.doe@example.com", sep: "."},
+			wantMapping:  "users",
+			wantPlainKey: "john.doe@example.com",
+		},
+		{
+			name:         "custom separator",
+			args:         args{key: "@@users/john.doe@example.com", sep: "/"},
+			wantMapping:  "users",
+			wantPlainKey: "john.doe@example.com",
+		},
+		{
+			name:         "multi-character separator",
+			args:         args{key: "@@users::a::b", sep: "::"},
+			wantMapping:  "users",
+			wantPlainKey: "a::b",
+		},
 		{
 			name:    "invalid key",
-			args:    args{key: "@@aaaaa"},
+			args:    args{key: "@@aaaaa", sep: "."},
+			wantErr: true,
+		},
+		{
+			name:    "custom separator missing",
+			args:    args{key: "@@users.john", sep: "/"},
+			wantErr: true,
+		},
+		{
+			name:    "empty mapping name",
+			args:    args{key: "@@.key", sep: "."},
+			wantErr: true,
+		},
+		{
+			name:    "empty key",
+			args:    args{key: "@@users.", sep: "."},
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := require.New(t)
-			got, got1, err := mappingKey(tt.args.key)
+			got, got1, err := mappingKey(tt.args.key, tt.args.sep)
 			if tt.wantErr {
 				r.Error(err)
 				return
@@ -330,6 +521,154 @@ func Test_tableProxy_Get(t *testing.T) {
 			},
 			wantErr: require.NoError,
 		},
+		{
+			name: "binary value",
+			fields: fields{
+				mapping: config.Mapping{
+					Name:        "default",
+					KeyColumn:   "key",
+					ValueColumn: "value",
+					Table:       "test",
+				},
+			},
+			args: args{key: "foo"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `value` FROM `test` WHERE `key`=?")
+				s.ExpectQuery("SELECT `value` FROM `test` WHERE `key`=.*").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte{0x00, '|', 0xff}))
+			},
+			want: &memcached.Item{
+				Value: []byte{0x00, '|', 0xff},
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name: "key found multiple values with escaping",
+			fields: fields{
+				mapping: config.Mapping{
+					Name:        "default",
+					KeyColumn:   "key",
+					ValueColumn: "value|value2",
+					Table:       "test",
+					Escape:      true,
+				},
+			},
+			args: args{key: "foo"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `value`,`value2` FROM `test` WHERE `key`=?")
+				s.ExpectQuery("SELECT `value`,`value2` FROM `test` WHERE `key`=.*").WillReturnRows(sqlmock.NewRows([]string{"value", "value2"}).AddRow("a|b", "c"))
+			},
+			want: &memcached.Item{
+				Value: []byte(`a\|b|c`),
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name: "NULL with null token",
+			fields: fields{
+				mapping: config.Mapping{
+					Name:        "default",
+					KeyColumn:   "key",
+					ValueColumn: "value|value2",
+					Table:       "test",
+					NullToken:   `\N`,
+				},
+			},
+			args: args{key: "foo"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `value`,`value2` FROM `test` WHERE `key`=?")
+				s.ExpectQuery("SELECT `value`,`value2` FROM `test` WHERE `key`=.*").WillReturnRows(sqlmock.NewRows([]string{"value", "value2"}).AddRow("", nil))
+			},
+			want: &memcached.Item{
+				Value: []byte(`|\N`),
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name: "NULL with null flag",
+			fields: fields{
+				mapping: config.Mapping{
+					Name:        "default",
+					KeyColumn:   "key",
+					ValueColumn: "value",
+					Table:       "test",
+					NullFlag:    true,
+				},
+			},
+			args: args{key: "foo"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `value` FROM `test` WHERE `key`=?")
+				s.ExpectQuery("SELECT `value` FROM `test` WHERE `key`=.*").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(nil))
+			},
+			want: &memcached.Item{
+				Value: []byte{},
+				Flags: FlagNull,
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name: "composite key",
+			fields: fields{
+				mapping: config.Mapping{
+					Name:         "default",
+					KeyColumn:    "tenant_id|user_id",
+					KeyDelimiter: ":",
+					ValueColumn:  "value",
+					Table:        "test",
+				},
+			},
+			args: args{key: "42:john:doe"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `value` FROM `test` WHERE `tenant_id`=\\? AND `user_id`=\\?")
+				s.ExpectQuery("SELECT `value` FROM `test` WHERE `tenant_id`=\\? AND `user_id`=\\?").WithArgs("42", "john:doe").WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow("bar"))
+			},
+			want: &memcached.Item{
+				Value: []byte("bar"),
+			},
+			wantErr: require.NoError,
+		},
+		{
+			name: "composite key with missing part",
+			fields: fields{
+				mapping: config.Mapping{
+					Name:        "default",
+					KeyColumn:   "tenant_id|user_id",
+					ValueColumn: "value",
+					Table:       "test",
+				},
+			},
+			args: args{key: "42"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `value` FROM `test` WHERE `tenant_id`=\\? AND `user_id`=\\?")
+			},
+			want:    nil,
+			wantErr: require.Error,
+		},
+		{
+			name: "key found as json",
+			fields: fields{
+				mapping: config.Mapping{
+					Name:        "default",
+					KeyColumn:   "key",
+					ValueColumn: "id|name|note",
+					Table:       "test",
+					Encoding:    config.EncodingJSON,
+				},
+			},
+			args: args{key: "foo"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("SELECT `id`,`name`,`note` FROM `test` WHERE `key`=?")
+				s.ExpectQuery("SELECT `id`,`name`,`note` FROM `test` WHERE `key`=.*").WillReturnRows(sqlmock.NewRowsWithColumnDefinition(
+					sqlmock.NewColumn("id").OfType("BIGINT", int64(0)),
+					sqlmock.NewColumn("name").OfType("VARCHAR", ""),
+					sqlmock.NewColumn("note").OfType("TEXT", ""),
+				).AddRow(int64(42), "bar", nil))
+			},
+			want: &memcached.Item{
+				Value: []byte(`{"id":42,"name":"bar","note":null}`),
+				Flags: FlagJSON,
+			},
+			wantErr: require.NoError,
+		},
 		{
 			name: "key not found",
 			fields: fields{
@@ -376,9 +715,201 @@ func Test_tableProxy_Get(t *testing.T) {
 			}
 			c, err := newTable(db, tt.fields.mapping)
 			require.NoError(t, err)
-			got, err := c.Get(tt.args.key)
+			got, err := c.Get(context.Background(), tt.args.key)
 			tt.wantErr(t, err)
 			require.Equal(t, tt.want, got)
 		})
 	}
 }
+
+func TestProxy_Set(t *testing.T) {
+	mappings := []config.Mapping{
+		{
+			Name:        "default",
+			KeyColumn:   "key",
+			ValueColumn: "value",
+			Table:       "test",
+		},
+		{
+			Name:        "users",
+			KeyColumn:   "id",
+			ValueColumn: "name|age",
+			Table:       "users",
+			Encoding:    config.EncodingJSON,
+		},
+		{
+			Name:        "notes",
+			KeyColumn:   "id",
+			ValueColumn: "title|body",
+			Table:       "notes",
+			NullToken:   `\N`,
+			NullFlag:    true,
+		},
+		{
+			Name:         "members",
+			KeyColumn:    "tenant_id|user_id",
+			KeyDelimiter: "/",
+			ValueColumn:  "role",
+			Table:        "members",
+		},
+	}
+	tests := []struct {
+		name string
+		item *memcached.Item
+		mock func(sqlmock.Sqlmock)
+		want memcached.MemcachedResponse
+	}{
+		{
+			name: "set raw value",
+			item: &memcached.Item{Key: "foo", Value: []byte("bar")},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `value` FROM `test` WHERE `key`=.*").WillReturnRows(sqlmock.NewRows([]string{"value"}))
+				s.ExpectPrepare("INSERT INTO `test` \\(`key`,`value`\\) VALUES \\(\\?,\\?\\) ON DUPLICATE KEY UPDATE `value`=VALUES\\(`value`\\)").
+					ExpectExec().WithArgs("foo", []byte("bar")).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			want: nil,
+		},
+		{
+			name: "set json value",
+			item: &memcached.Item{Key: "@@users.1", Value: []byte(`{"age":30,"name":"joe"}`)},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `name`,`age` FROM `users` WHERE `id`=.*").WillReturnRows(sqlmock.NewRows([]string{"name", "age"}))
+				s.ExpectPrepare("INSERT INTO `users` .+ ON DUPLICATE KEY UPDATE `name`=VALUES\\(`name`\\),`age`=VALUES\\(`age`\\)").
+					ExpectExec().WithArgs("1", []byte("joe"), []byte("30")).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			want: nil,
+		},
+		{
+			name: "set null token",
+			item: &memcached.Item{Key: "@@notes.1", Value: []byte(`\N|`)},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `title`,`body` FROM `notes` WHERE `id`=.*").WillReturnRows(sqlmock.NewRows([]string{"title", "body"}))
+				s.ExpectPrepare("INSERT INTO `notes`").ExpectExec().WithArgs("1", nil, []byte{}).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			want: nil,
+		},
+		{
+			name: "set null flag",
+			item: &memcached.Item{Key: "@@notes.1", Value: []byte("ignored"), Flags: FlagNull},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectPrepare("INSERT INTO `notes`").ExpectExec().WithArgs("1", nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			want: nil,
+		},
+		{
+			name: "set composite key",
+			item: &memcached.Item{Key: "@@members.42/7", Value: []byte("admin")},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `role` FROM `members` WHERE .+").WithArgs(nil, nil).WillReturnRows(sqlmock.NewRows([]string{"role"}))
+				s.ExpectPrepare("INSERT INTO `members` \\(`tenant_id`,`user_id`,`role`\\) VALUES \\(\\?,\\?,\\?\\)").
+					ExpectExec().WithArgs("42", "7", []byte("admin")).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			want: nil,
+		},
+		{
+			name: "malformed json value",
+			item: &memcached.Item{Key: "@@users.1", Value: []byte(`{"name":"joe"}`)},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `name`,`age` FROM `users` WHERE `id`=.*").WillReturnRows(sqlmock.NewRows([]string{"name", "age"}))
+			},
+			want: &memcached.ClientErrorResponse{Reason: errMalformedValue.Error()},
+		},
+		{
+			name: "unknown mapping",
+			item: &memcached.Item{Key: "@@unknown.1", Value: []byte("bar")},
+			want: &memcached.StatusResponse{Status: memcached.StatusNotStored},
+		},
+		{
+			name: "write failed",
+			item: &memcached.Item{Key: "foo", Value: []byte("bar")},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `value` FROM `test` WHERE `key`=.*").WillReturnRows(sqlmock.NewRows([]string{"value"}))
+				s.ExpectPrepare("INSERT INTO `test`").ExpectExec().WillReturnError(errors.New("unknown error"))
+			},
+			want: &memcached.StatusResponse{Status: memcached.StatusServerError},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, s, err := sqlmock.New()
+			require.NoError(t, err)
+			s.ExpectPrepare("SELECT `value` FROM `test` WHERE `key`=?")
+			s.ExpectPrepare("SELECT `name`,`age` FROM `users` WHERE `id`=?")
+			s.ExpectPrepare("SELECT `title`,`body` FROM `notes` WHERE `id`=?")
+			s.ExpectPrepare("SELECT `role` FROM `members` WHERE `tenant_id`=\\? AND `user_id`=\\?")
+			if tt.mock != nil {
+				tt.mock(s)
+			}
+			c, err := New(db, mappings)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, c.Set(tt.item))
+			require.NoError(t, s.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestProxy_Scan(t *testing.T) {
+	mappings := []config.Mapping{
+		{Name: "default", KeyColumn: "key", ValueColumn: "value", Table: "test"},
+		{Name: "users", KeyColumn: "id", ValueColumn: "name", Table: "users", KeyTransform: []config.KeyTransform{{Integer: true}}},
+	}
+	tests := []struct {
+		name string
+		cmd  *memcached.ScanCmd
+		mock func(sqlmock.Sqlmock)
+		want memcached.MemcachedResponse
+	}{
+		{
+			name: "prefix scan",
+			cmd:  &memcached.ScanCmd{Kind: memcached.ScanPrefix, Prefix: "@@default.tenant_42:", Limit: 10},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `value` FROM `test` WHERE `key`=.+").WillReturnRows(sqlmock.NewRows([]string{"value"}))
+				s.ExpectPrepare("SELECT `key`,`value` FROM `test` WHERE `key` LIKE \\? ORDER BY `key` LIMIT \\?").
+					ExpectQuery().WithArgs(`tenant\_42:%`, 10).
+					WillReturnRows(sqlmock.NewRows([]string{"key", "value"}).AddRow("tenant_42:a", "1").AddRow("tenant_42:b", "2"))
+			},
+			want: &memcached.BulkResponse{Responses: []memcached.MemcachedResponse{
+				&memcached.ItemResponse{Item: &memcached.Item{Key: "@@default.tenant_42:a", Value: []byte("1")}},
+				&memcached.ItemResponse{Item: &memcached.Item{Key: "@@default.tenant_42:b", Value: []byte("2")}},
+			}},
+		},
+		{
+			name: "range scan",
+			cmd:  &memcached.ScanCmd{Kind: memcached.ScanRange, From: "a", To: "c", Limit: 1},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery("SELECT `value` FROM `test` WHERE `key`=.+").WillReturnRows(sqlmock.NewRows([]string{"value"}))
+				s.ExpectPrepare("SELECT `key`,`value` FROM `test` WHERE `key` BETWEEN \\? AND \\? ORDER BY `key` LIMIT \\?").
+					ExpectQuery().WithArgs("a", "c", 1).
+					WillReturnRows(sqlmock.NewRows([]string{"key", "value"}).AddRow("b", "1"))
+			},
+			want: &memcached.BulkResponse{Responses: []memcached.MemcachedResponse{
+				&memcached.ItemResponse{Item: &memcached.Item{Key: "b", Value: []byte("1")}},
+			}},
+		},
+		{
+			name: "range across mappings",
+			cmd:  &memcached.ScanCmd{Kind: memcached.ScanRange, From: "a", To: "@@users.1", Limit: 1},
+			want: &memcached.ClientErrorResponse{Reason: "range spans multiple mappings"},
+		},
+		{
+			name: "mapping with transformed keys",
+			cmd:  &memcached.ScanCmd{Kind: memcached.ScanPrefix, Prefix: "@@users.1", Limit: 1},
+			want: &memcached.ClientErrorResponse{Reason: errNotScannable.Error()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, s, err := sqlmock.New()
+			require.NoError(t, err)
+			s.ExpectPrepare("SELECT `value` FROM `test` WHERE `key`=?")
+			s.ExpectPrepare("SELECT `name` FROM `users` WHERE `id`=?")
+			if tt.mock != nil {
+				tt.mock(s)
+			}
+			c, err := New(db, mappings)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, c.Scan(tt.cmd))
+			require.NoError(t, s.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/coufalja/memcached-mysql/config"
+)
+
+// router resolves mappings of keys by the longest matching prefix, then by regular expressions in order.
+type router struct {
+	prefixes *prefixNode
+	regexes  []regexRoute
+}
+
+type regexRoute struct {
+	re      *regexp.Regexp
+	mapping string
+}
+
+// prefixNode is a node of a byte-wise trie of route prefixes.
+type prefixNode struct {
+	children map[byte]*prefixNode
+	// mapping is set if a prefix ends at the node.
+	mapping string
+}
+
+func newRouter(routes []config.Route) (*router, error) {
+	r := &router{prefixes: &prefixNode{}}
+	for _, route := range routes {
+		switch {
+		case route.Prefix != "":
+			r.prefixes.insert(route.Prefix, route.Mapping)
+		case route.Regex != "":
+			re, err := regexp.Compile(route.Regex)
+			if err != nil {
+				return nil, err
+			}
+			r.regexes = append(r.regexes, regexRoute{re: re, mapping: route.Mapping})
+		default:
+			return nil, fmt.Errorf("route to %s has neither prefix nor regex", route.Mapping)
+		}
+	}
+	return r, nil
+}
+
+func (n *prefixNode) insert(prefix, mapping string) {
+	for i := 0; i < len(prefix); i++ {
+		if n.children == nil {
+			n.children = make(map[byte]*prefixNode)
+		}
+		child, ok := n.children[prefix[i]]
+		if !ok {
+			child = &prefixNode{}
+			n.children[prefix[i]] = child
+		}
+		n = child
+	}
+	n.mapping = mapping
+}
+
+// route returns the mapping of the key, ok is false if no route matches.
+func (r *router) route(key string) (string, bool) {
+	mapping, n := "", r.prefixes
+	for i := 0; i < len(key) && n != nil; i++ {
+		if n = n.children[key[i]]; n != nil && n.mapping != "" {
+			mapping = n.mapping
+		}
+	}
+	if mapping != "" {
+		return mapping, true
+	}
+	for _, route := range r.regexes {
+		if route.re.MatchString(key) {
+			return route.mapping, true
+		}
+	}
+	return "", false
+}
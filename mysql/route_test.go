@@ -0,0 +1,65 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_router(t *testing.T) {
+	r, err := newRouter([]config.Route{
+		{Prefix: "sess:", Mapping: "sessions"},
+		{Prefix: "sess:admin:", Mapping: "admins"},
+		{Prefix: "cnt:", Mapping: "counters"},
+		{Regex: `^\d+$`, Mapping: "ids"},
+		{Regex: `^[a-z]+$`, Mapping: "words"},
+	})
+	require.NoError(t, err)
+	tests := []struct {
+		key         string
+		wantMapping string
+		wantOk      bool
+	}{
+		{key: "sess:abc", wantMapping: "sessions", wantOk: true},
+		{key: "sess:admin:1", wantMapping: "admins", wantOk: true},
+		{key: "sess:admin", wantMapping: "sessions", wantOk: true},
+		{key: "cnt:", wantMapping: "counters", wantOk: true},
+		{key: "cnt", wantMapping: "words", wantOk: true},
+		{key: "123", wantMapping: "ids", wantOk: true},
+		{key: "other:1", wantOk: false},
+		{key: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			mapping, ok := r.route(tt.key)
+			require.Equal(t, tt.wantOk, ok)
+			require.Equal(t, tt.wantMapping, mapping)
+		})
+	}
+}
+
+func TestProxy_SetRoutes(t *testing.T) {
+	db, s, err := sqlmock.New()
+	require.NoError(t, err)
+	s.ExpectPrepare("SELECT `value` FROM `test` WHERE `key`=?")
+	s.ExpectPrepare("SELECT `value` FROM `sessions` WHERE `key`=?")
+	c, err := New(db, []config.Mapping{
+		{Name: "default", KeyColumn: "key", ValueColumn: "value", Table: "test"},
+		{Name: "sessions", KeyColumn: "key", ValueColumn: "value", Table: "sessions"},
+	})
+	require.NoError(t, err)
+	require.Error(t, c.SetRoutes([]config.Route{{Prefix: "cnt:", Mapping: "counters"}}))
+	require.NoError(t, c.SetRoutes([]config.Route{{Prefix: "sess:", Mapping: "sessions"}}))
+
+	for key, want := range map[string][2]string{
+		"sess:1":       {"sessions", "sess:1"},
+		"other":        {"default", "other"},
+		"@@sessions.2": {"sessions", "2"},
+	} {
+		mapping, ckey, err := c.resolve(key)
+		require.NoError(t, err)
+		require.Equal(t, want, [2]string{mapping, ckey}, key)
+	}
+}
@@ -0,0 +1,223 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/coufalja/memcached-mysql/config"
+)
+
+const (
+	columnsQuery = "SELECT `COLUMN_NAME`,`DATA_TYPE`,`COLUMN_TYPE`,`IS_NULLABLE` FROM `information_schema`.`COLUMNS` " +
+		"WHERE `TABLE_SCHEMA`=COALESCE(?,DATABASE()) AND `TABLE_NAME`=?"
+	indexesQuery = "SELECT `INDEX_NAME`,`NON_UNIQUE`,`COLUMN_NAME` FROM `information_schema`.`STATISTICS` " +
+		"WHERE `TABLE_SCHEMA`=COALESCE(?,DATABASE()) AND `TABLE_NAME`=? ORDER BY `INDEX_NAME`,`SEQ_IN_INDEX`"
+)
+
+// Column is a column of a mapped table as described by information_schema.
+type Column struct {
+	Name string
+	// DataType is the type name, e.g. varchar, while ColumnType is the full definition, e.g. varchar(255).
+	DataType   string
+	ColumnType string
+	Nullable   bool
+}
+
+func (c Column) String() string {
+	if c.Nullable {
+		return fmt.Sprintf("%s %s NULL", c.Name, c.ColumnType)
+	}
+	return fmt.Sprintf("%s %s NOT NULL", c.Name, c.ColumnType)
+}
+
+// SchemaReport is the result of verifying a mapping against the schema of its table.
+type SchemaReport struct {
+	Mapping string
+	Table   string
+	// KeyUnique is true if the key column is covered by a primary or unique index.
+	KeyUnique bool
+	// Columns are the mapped value columns found in the table.
+	Columns []Column
+	// Errors are mismatches which make the mapping unusable or ambiguous.
+	Errors []string
+	// Warnings are value conversions which may not round-trip exactly.
+	Warnings []string
+}
+
+// VerifySchema introspects tables of the mappings through information_schema and checks that
+// the key column is unique and all columns exist, reporting value column types and their conversion issues.
+func VerifySchema(ctx context.Context, db *sql.DB, mapping []config.Mapping) ([]SchemaReport, error) {
+	reports := make([]SchemaReport, 0, len(mapping))
+	for _, m := range mapping {
+		report, err := verifyMapping(ctx, db, m)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %s: %w", m.Name, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func verifyMapping(ctx context.Context, db *sql.DB, m config.Mapping) (SchemaReport, error) {
+	report := SchemaReport{Mapping: m.Name, Table: m.Table}
+	if m.Query != "" {
+		// Custom queries may join tables and compute columns, they are checked by running them when the proxy starts.
+		report.Warnings = append(report.Warnings, "mapping with a custom query is not verified against the schema")
+		return report, nil
+	}
+	schema, table := splitTableName(m.Table)
+
+	columns, err := tableColumns(ctx, db, schema, table)
+	if err != nil {
+		return report, err
+	}
+	if len(columns) == 0 {
+		report.Errors = append(report.Errors, fmt.Sprintf("table %s does not exist", m.Table))
+		return report, nil
+	}
+
+	keyColumns := strings.Split(m.KeyColumn, valueSeparator)
+	for _, name := range keyColumns {
+		if _, ok := columns[name]; !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("key column %s does not exist", name))
+		}
+	}
+	valueColumns := strings.Split(m.ValueColumn, valueSeparator)
+	// Binary data is ambiguous only when joined by separators which are not escaped.
+	joined := len(valueColumns) > 1 && (m.Encoding == "" || m.Encoding == config.EncodingDelimited) && !m.Escape
+	for _, name := range valueColumns {
+		column, ok := columns[name]
+		if !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("value column %s does not exist", name))
+			continue
+		}
+		report.Columns = append(report.Columns, column)
+		if warning := conversionWarning(column, joined); warning != "" {
+			report.Warnings = append(report.Warnings, warning)
+		}
+	}
+
+	indexes, err := uniqueIndexes(ctx, db, schema, table)
+	if err != nil {
+		return report, err
+	}
+	report.KeyUnique = uniqueKey(indexes, keyColumns)
+	if !report.KeyUnique {
+		report.Errors = append(report.Errors, fmt.Sprintf("key %s is not covered by a primary or unique index", strings.Join(keyColumns, columnSeparator)))
+	}
+	for _, name := range m.Lookups {
+		if _, ok := columns[name]; !ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("lookup column %s does not exist", name))
+		} else if !uniqueKey(indexes, []string{name}) {
+			report.Errors = append(report.Errors, fmt.Sprintf("lookup column %s is not covered by a unique index", name))
+		}
+	}
+	return report, nil
+}
+
+// splitTableName splits "database.table" into its parts, database is invalid if not present.
+func splitTableName(name string) (sql.NullString, string) {
+	if schema, table, ok := strings.Cut(name, tableNameSeparator); ok {
+		return sql.NullString{String: schema, Valid: true}, table
+	}
+	return sql.NullString{}, name
+}
+
+func tableColumns(ctx context.Context, db *sql.DB, schema sql.NullString, table string) (map[string]Column, error) {
+	rows, err := db.QueryContext(ctx, columnsQuery, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]Column)
+	for rows.Next() {
+		var column Column
+		var nullable string
+		if err := rows.Scan(&column.Name, &column.DataType, &column.ColumnType, &nullable); err != nil {
+			return nil, err
+		}
+		column.DataType = strings.ToLower(column.DataType)
+		column.Nullable = nullable == "YES"
+		columns[column.Name] = column
+	}
+	return columns, rows.Err()
+}
+
+// uniqueIndexes returns columns of primary and unique indexes of the table.
+func uniqueIndexes(ctx context.Context, db *sql.DB, schema sql.NullString, table string) ([][]string, error) {
+	rows, err := db.QueryContext(ctx, indexesQuery, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	indexes := make(map[string][]string)
+	unique := make(map[string]bool)
+	for rows.Next() {
+		var index, column string
+		var nonUnique int
+		if err := rows.Scan(&index, &nonUnique, &column); err != nil {
+			return nil, err
+		}
+		if _, ok := indexes[index]; !ok {
+			names = append(names, index)
+		}
+		indexes[index] = append(indexes[index], column)
+		unique[index] = nonUnique == 0
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var result [][]string
+	for _, index := range names {
+		if unique[index] {
+			result = append(result, indexes[index])
+		}
+	}
+	return result, nil
+}
+
+// uniqueKey checks whether one of the unique indexes consists of exactly the key columns, in any order.
+func uniqueKey(indexes [][]string, key []string) bool {
+	for _, columns := range indexes {
+		if sameColumns(columns, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, c := range a {
+		seen[c] = true
+	}
+	for _, c := range b {
+		if !seen[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// conversionWarning describes how the column value may be altered by converting it to a memcached value,
+// joined tells whether the value is joined with other columns by unescaped separators.
+func conversionWarning(c Column, joined bool) string {
+	switch c.DataType {
+	case "tinyblob", "blob", "mediumblob", "longblob", "binary", "varbinary", "bit":
+		if !joined {
+			return ""
+		}
+		return fmt.Sprintf("column %s holds binary data which is ambiguous when joined with other columns", c.Name)
+	case "tinytext", "text", "mediumtext", "longtext":
+		return fmt.Sprintf("column %s holds text which may exceed the maximum item size", c.Name)
+	case "float", "double", "real":
+		return fmt.Sprintf("column %s holds approximate numbers whose text form may lose precision", c.Name)
+	}
+	return ""
+}
@@ -0,0 +1,175 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coufalja/memcached-mysql/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySchema(t *testing.T) {
+	columns := []string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE", "IS_NULLABLE"}
+	indexes := []string{"INDEX_NAME", "NON_UNIQUE", "COLUMN_NAME"}
+	tests := []struct {
+		name    string
+		mapping config.Mapping
+		mock    func(sqlmock.Sqlmock)
+		want    SchemaReport
+	}{
+		{
+			name:    "matching schema",
+			mapping: config.Mapping{Name: "default", Table: "db.test", KeyColumn: "key", ValueColumn: "value|price"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery(regexp.QuoteMeta(columnsQuery)).WithArgs("db", "test").WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("key", "varchar", "varchar(64)", "NO").
+					AddRow("value", "varchar", "varchar(255)", "YES").
+					AddRow("price", "double", "double", "NO"))
+				s.ExpectQuery(regexp.QuoteMeta(indexesQuery)).WithArgs("db", "test").WillReturnRows(sqlmock.NewRows(indexes).
+					AddRow("PRIMARY", 0, "key"))
+			},
+			want: SchemaReport{
+				Mapping:   "default",
+				Table:     "db.test",
+				KeyUnique: true,
+				Columns: []Column{
+					{Name: "value", DataType: "varchar", ColumnType: "varchar(255)", Nullable: true},
+					{Name: "price", DataType: "double", ColumnType: "double"},
+				},
+				Warnings: []string{"column price holds approximate numbers whose text form may lose precision"},
+			},
+		},
+		{
+			name:    "binary columns",
+			mapping: config.Mapping{Name: "default", Table: "test", KeyColumn: "key", ValueColumn: "data|name"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery(regexp.QuoteMeta(columnsQuery)).WithArgs(nil, "test").WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("key", "varchar", "varchar(64)", "NO").
+					AddRow("data", "blob", "blob", "NO").
+					AddRow("name", "varchar", "varchar(64)", "NO"))
+				s.ExpectQuery(regexp.QuoteMeta(indexesQuery)).WithArgs(nil, "test").WillReturnRows(sqlmock.NewRows(indexes).
+					AddRow("PRIMARY", 0, "key"))
+			},
+			want: SchemaReport{
+				Mapping:   "default",
+				Table:     "test",
+				KeyUnique: true,
+				Columns: []Column{
+					{Name: "data", DataType: "blob", ColumnType: "blob"},
+					{Name: "name", DataType: "varchar", ColumnType: "varchar(64)"},
+				},
+				Warnings: []string{"column data holds binary data which is ambiguous when joined with other columns"},
+			},
+		},
+		{
+			name:    "escaped binary columns",
+			mapping: config.Mapping{Name: "default", Table: "test", KeyColumn: "key", ValueColumn: "data|name", Escape: true},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery(regexp.QuoteMeta(columnsQuery)).WithArgs(nil, "test").WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("key", "varchar", "varchar(64)", "NO").
+					AddRow("data", "blob", "blob", "NO").
+					AddRow("name", "varchar", "varchar(64)", "NO"))
+				s.ExpectQuery(regexp.QuoteMeta(indexesQuery)).WithArgs(nil, "test").WillReturnRows(sqlmock.NewRows(indexes).
+					AddRow("PRIMARY", 0, "key"))
+			},
+			want: SchemaReport{
+				Mapping:   "default",
+				Table:     "test",
+				KeyUnique: true,
+				Columns: []Column{
+					{Name: "data", DataType: "blob", ColumnType: "blob"},
+					{Name: "name", DataType: "varchar", ColumnType: "varchar(64)"},
+				},
+			},
+		},
+		{
+			name:    "missing column and non-unique key",
+			mapping: config.Mapping{Name: "default", Table: "test", KeyColumn: "key", ValueColumn: "missing"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery(regexp.QuoteMeta(columnsQuery)).WithArgs(nil, "test").WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("key", "varchar", "varchar(64)", "NO"))
+				s.ExpectQuery(regexp.QuoteMeta(indexesQuery)).WithArgs(nil, "test").WillReturnRows(sqlmock.NewRows(indexes).
+					AddRow("idx_key", 1, "key").
+					AddRow("uniq_other", 0, "key").
+					AddRow("uniq_other", 0, "other"))
+			},
+			want: SchemaReport{
+				Mapping: "default",
+				Table:   "test",
+				Errors: []string{
+					"value column missing does not exist",
+					"key key is not covered by a primary or unique index",
+				},
+			},
+		},
+		{
+			name:    "composite key",
+			mapping: config.Mapping{Name: "default", Table: "test", KeyColumn: "tenant_id|user_id", ValueColumn: "name"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery(regexp.QuoteMeta(columnsQuery)).WithArgs(nil, "test").WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("tenant_id", "int", "int", "NO").
+					AddRow("user_id", "int", "int", "NO").
+					AddRow("name", "varchar", "varchar(64)", "NO"))
+				s.ExpectQuery(regexp.QuoteMeta(indexesQuery)).WithArgs(nil, "test").WillReturnRows(sqlmock.NewRows(indexes).
+					AddRow("PRIMARY", 0, "user_id").
+					AddRow("PRIMARY", 0, "tenant_id"))
+			},
+			want: SchemaReport{
+				Mapping:   "default",
+				Table:     "test",
+				KeyUnique: true,
+				Columns:   []Column{{Name: "name", DataType: "varchar", ColumnType: "varchar(64)"}},
+			},
+		},
+		{
+			name:    "lookup columns",
+			mapping: config.Mapping{Name: "users", Table: "users", KeyColumn: "id", ValueColumn: "name", Lookups: []string{"email", "nick", "phone"}},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery(regexp.QuoteMeta(columnsQuery)).WithArgs(nil, "users").WillReturnRows(sqlmock.NewRows(columns).
+					AddRow("id", "int", "int", "NO").
+					AddRow("name", "varchar", "varchar(64)", "NO").
+					AddRow("email", "varchar", "varchar(255)", "NO").
+					AddRow("nick", "varchar", "varchar(64)", "NO"))
+				s.ExpectQuery(regexp.QuoteMeta(indexesQuery)).WithArgs(nil, "users").WillReturnRows(sqlmock.NewRows(indexes).
+					AddRow("PRIMARY", 0, "id").
+					AddRow("uniq_email", 0, "email").
+					AddRow("idx_nick", 1, "nick"))
+			},
+			want: SchemaReport{
+				Mapping:   "users",
+				Table:     "users",
+				KeyUnique: true,
+				Columns:   []Column{{Name: "name", DataType: "varchar", ColumnType: "varchar(64)"}},
+				Errors: []string{
+					"lookup column nick is not covered by a unique index",
+					"lookup column phone does not exist",
+				},
+			},
+		},
+		{
+			name:    "missing table",
+			mapping: config.Mapping{Name: "default", Table: "test", KeyColumn: "key", ValueColumn: "value"},
+			mock: func(s sqlmock.Sqlmock) {
+				s.ExpectQuery(regexp.QuoteMeta(columnsQuery)).WillReturnRows(sqlmock.NewRows(columns))
+			},
+			want: SchemaReport{
+				Mapping: "default",
+				Table:   "test",
+				Errors:  []string{"table test does not exist"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			tt.mock(mock)
+			got, err := VerifySchema(context.Background(), db, []config.Mapping{tt.mapping})
+			require.NoError(t, err)
+			require.Equal(t, []SchemaReport{tt.want}, got)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}